@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"tls-proxy/config"
+)
+
+// 管理接口的统计查询，均为 GET，返回 JSON；参数错误返回 400，Redis 出错返回 500
+//
+//	/stats/series?kind=ja4&series=blocked&fp=<指纹>&res=m&from=<时间>&to=<时间>
+//	/stats/fingerprints?kind=ja4&fp=<指纹>&fp=<指纹>  指定指纹的统计
+//	/stats/fingerprints?kind=ja4&limit=20            连接次数最多的指纹
+//	/stats/new?kind=ja4&since=<时间>&limit=20        since 之后首次出现的指纹，since 默认为 24 小时前
+//
+// 时间可以是 Unix 秒或 RFC 3339，to 默认为当前时间，from 默认为 to 之前 1 小时
+func registerStatsHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/stats/series", handleSeries)
+	mux.HandleFunc("/stats/fingerprints", handleFingerprints)
+	mux.HandleFunc("/stats/new", handleNewFingerprints)
+}
+
+// 列表查询的默认条数与上限
+const (
+	defaultStatsLimit = 20
+	maxStatsLimit     = 1000
+)
+
+func handleSeries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	kind, series, fp, res := q.Get("kind"), q.Get("series"), q.Get("fp"), q.Get("res")
+	switch kind {
+	case config.KindJA3, config.KindJA3N, config.KindJA4, config.RuleRateLimit:
+	default:
+		http.Error(w, "kind 应为 ja3、ja3n、ja4 或 ratelimit", http.StatusBadRequest)
+		return
+	}
+	switch series {
+	case config.SeriesBlocked, config.SeriesCollected:
+	default:
+		http.Error(w, "series 应为 blocked 或 collected", http.StatusBadRequest)
+		return
+	}
+	if fp == "" {
+		http.Error(w, "缺少 fp", http.StatusBadRequest)
+		return
+	}
+	switch res {
+	case "":
+		res = config.ResMinute
+	case config.ResMinute, config.ResHour, config.ResDay:
+	default:
+		http.Error(w, "res 应为 m、h 或 d", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(q.Get("from"), to.Add(-time.Hour))
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to 早于 from", http.StatusBadRequest)
+		return
+	}
+	points, err := config.QuerySeries(kind, series, fp, res, from, to)
+	if err != nil {
+		writeStatsError(w, r, err)
+		return
+	}
+	writeJSON(w, points)
+}
+
+func handleFingerprints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	kind := q.Get("kind")
+	if !validFingerprintKind(kind) {
+		http.Error(w, "kind 应为 ja3、ja3n 或 ja4", http.StatusBadRequest)
+		return
+	}
+	var (
+		stats []config.FingerprintStat
+		err   error
+	)
+	if fps := q["fp"]; len(fps) > 0 {
+		if len(fps) > maxStatsLimit {
+			http.Error(w, fmt.Sprintf("fp 最多 %d 个", maxStatsLimit), http.StatusBadRequest)
+			return
+		}
+		stats, err = config.GetFingerprintStats(kind, fps...)
+	} else {
+		limit, lerr := parseLimitParam(q.Get("limit"))
+		if lerr != nil {
+			http.Error(w, lerr.Error(), http.StatusBadRequest)
+			return
+		}
+		stats, err = config.TopFingerprints(kind, limit)
+	}
+	if err != nil {
+		writeStatsError(w, r, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func handleNewFingerprints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	kind := q.Get("kind")
+	if !validFingerprintKind(kind) {
+		http.Error(w, "kind 应为 ja3、ja3n 或 ja4", http.StatusBadRequest)
+		return
+	}
+	since, err := parseTimeParam(q.Get("since"), time.Now().Add(-24*time.Hour))
+	if err != nil {
+		http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimitParam(q.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := config.ListNewFingerprints(kind, since, limit)
+	if err != nil {
+		writeStatsError(w, r, err)
+		return
+	}
+	writeJSON(w, list)
+}
+
+func validFingerprintKind(kind string) bool {
+	switch kind {
+	case config.KindJA3, config.KindJA3N, config.KindJA4:
+		return true
+	}
+	return false
+}
+
+// parseLimitParam 解析条数，为空时使用默认值，范围为 1 到 maxStatsLimit
+func parseLimitParam(s string) (int64, error) {
+	if s == "" {
+		return defaultStatsLimit, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 || n > maxStatsLimit {
+		return 0, fmt.Errorf("limit 应为 1 到 %d 的整数", maxStatsLimit)
+	}
+	return n, nil
+}
+
+// parseTimeParam 解析 Unix 秒或 RFC 3339 时间，为空时返回 def
+func parseTimeParam(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间: %s", s)
+	}
+	return t, nil
+}
+
+func writeStatsError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Warn("[WARN] 统计查询失败", "path", r.URL.Path, "err", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("[WARN] 输出统计结果失败", "err", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	def := time.Unix(100, 0)
+	tests := map[string]time.Time{
+		"":                     def,
+		"1700000000":           time.Unix(1700000000, 0),
+		"2024-03-01T00:00:00Z": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for s, want := range tests {
+		if got, err := parseTimeParam(s, def); err != nil || !got.Equal(want) {
+			t.Errorf("parseTimeParam(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := parseTimeParam("yesterday", def); err == nil {
+		t.Error("无效的时间应返回错误")
+	}
+}
+
+func TestStatsBadRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	registerStatsHandlers(mux)
+	for _, url := range []string{
+		"/stats/series?kind=md5&series=blocked&fp=x",
+		"/stats/series?kind=ja4&series=other&fp=x",
+		"/stats/series?kind=ja4&series=blocked",
+		"/stats/series?kind=ja4&series=blocked&fp=x&res=w",
+		"/stats/series?kind=ja4&series=blocked&fp=x&from=200&to=100",
+		"/stats/fingerprints?kind=ratelimit",
+		"/stats/fingerprints?kind=ja4&limit=0",
+		"/stats/fingerprints?kind=ja4&limit=abc",
+		"/stats/new?kind=ja4&since=soon",
+		"/stats/new?kind=ja4&limit=5000",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", url, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+// 访问日志的采样率：正常转发的连接按比例记录，阻止、分流、限速等连接始终记录
+var accessLogSampleRate = 1.0
+
+func refreshAccessLogFlags() {
+	_accessLogSampleRate, _ := getFloat("config:accesslog_sample_rate", accessLogSampleRate)
+	if _accessLogSampleRate < 0 {
+		_accessLogSampleRate = 0
+	}
+
+	mu.Lock()
+	accessLogSampleRate = _accessLogSampleRate
+	mu.Unlock()
+}
+
+// AccessLogSampleRate 返回正常转发连接的访问日志采样率（0~1）
+func AccessLogSampleRate() float64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	return accessLogSampleRate
+}
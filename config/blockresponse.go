@@ -0,0 +1,93 @@
+package config
+
+import (
+	"log/slog"
+)
+
+// 阻止连接时的响应方式
+const (
+	BlockClose                 = "close"                   // 直接关闭（FIN）
+	BlockRST                   = "rst"                     // SO_LINGER 0 后关闭，发送 RST
+	BlockAlertHandshakeFailure = "alert:handshake_failure" // 发送 TLS fatal alert 后关闭
+	BlockAlertAccessDenied     = "alert:access_denied"
+	BlockAlertUnrecognizedName = "alert:unrecognized_name"
+	BlockTarpit                = "tarpit" // 保持连接并缓慢发送数据，消耗对方资源
+)
+
+// 阻止规则，ip/ja3/ja3n/ja4 与临时封禁类型一致
+const (
+	RuleFirstFlight = "firstflight"
+	RuleRateLimit   = "ratelimit"
+	RuleConnLimit   = "connlimit"
+)
+
+// 阻止响应配置：
+//   - 哈希 config:block_response，字段为规则名称（ip、ja3、ja3n、ja4、firstflight、ratelimit、connlimit）
+//     或 default，值为响应方式
+//   - 哈希 <ip|ja3|ja3n|ja4>:block_response，字段为具体的 IP 或指纹，优先于规则级配置
+var (
+	blockResponseKinds = []string{KindIP, KindJA3, KindJA3N, KindJA4}
+
+	blockResponses      = map[string]string{"default": BlockClose}
+	entryBlockResponses = make(map[string]map[string]string)
+)
+
+func validBlockResponse(action string) bool {
+	switch action {
+	case BlockClose, BlockRST, BlockAlertHandshakeFailure, BlockAlertAccessDenied, BlockAlertUnrecognizedName, BlockTarpit:
+		return true
+	}
+	return false
+}
+
+// loadBlockResponses 读取响应方式哈希，忽略无效的取值
+func loadBlockResponses(key string) (map[string]string, error) {
+	m, err := rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	for field, action := range m {
+		if !validBlockResponse(action) {
+			slog.Warn("[WARN] 无效的阻止响应方式", "key", key, "field", field, "action", action)
+			delete(m, field)
+		}
+	}
+	return m, nil
+}
+
+func refreshBlockResponses() error {
+	_blockResponses, err := loadBlockResponses("config:block_response")
+	if err != nil {
+		return err
+	}
+	if _, ok := _blockResponses["default"]; !ok {
+		_blockResponses["default"] = BlockClose
+	}
+	_entryBlockResponses := make(map[string]map[string]string, len(blockResponseKinds))
+	for _, kind := range blockResponseKinds {
+		m, err := loadBlockResponses(kind + ":block_response")
+		if err != nil {
+			return err
+		}
+		_entryBlockResponses[kind] = m
+	}
+
+	mu.Lock()
+	blockResponses = _blockResponses
+	entryBlockResponses = _entryBlockResponses
+	mu.Unlock()
+	return nil
+}
+
+// GetBlockResponse 返回被某条规则阻止的连接应使用的响应方式，value 为命中的 IP 或指纹
+func GetBlockResponse(rule, value string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if action, ok := entryBlockResponses[rule][value]; ok {
+		return action
+	}
+	if action, ok := blockResponses[rule]; ok {
+		return action
+	}
+	return blockResponses["default"]
+}
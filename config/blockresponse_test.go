@@ -0,0 +1,52 @@
+package config
+
+import "testing"
+
+func TestGetBlockResponse(t *testing.T) {
+	s := useTestRedis(t)
+	mu.RLock()
+	oldResponses, oldEntries := blockResponses, entryBlockResponses
+	mu.RUnlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		blockResponses, entryBlockResponses = oldResponses, oldEntries
+		mu.Unlock()
+	})
+
+	s.HSet("config:block_response", RuleFirstFlight, BlockRST, KindJA4, BlockTarpit, KindIP, "drop")
+	s.HSet(KindJA4+":block_response", "fp-alert", BlockAlertAccessDenied, "fp-bad", "alert:unknown")
+	s.HSet(KindIP+":block_response", "192.0.2.1", BlockAlertHandshakeFailure)
+	if err := refreshBlockResponses(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		value string
+		want  string
+	}{
+		{"规则级配置", RuleFirstFlight, "", BlockRST},
+		{"未配置的规则使用默认值", RuleRateLimit, "", BlockClose},
+		{"具体指纹优先于规则级配置", KindJA4, "fp-alert", BlockAlertAccessDenied},
+		{"未单独配置的指纹使用规则级配置", KindJA4, "fp-other", BlockTarpit},
+		{"无效的指纹配置被忽略", KindJA4, "fp-bad", BlockTarpit},
+		{"具体 IP 优先于默认值", KindIP, "192.0.2.1", BlockAlertHandshakeFailure},
+		{"无效的规则级配置被忽略", KindIP, "192.0.2.2", BlockClose},
+		{"指纹配置只作用于对应类型", KindJA3, "fp-alert", BlockClose},
+	}
+	for _, tt := range tests {
+		if got := GetBlockResponse(tt.rule, tt.value); got != tt.want {
+			t.Errorf("%s: GetBlockResponse(%q, %q) = %q, want %q", tt.name, tt.rule, tt.value, got, tt.want)
+		}
+	}
+
+	// default 可以修改
+	s.HSet("config:block_response", "default", BlockRST)
+	if err := refreshBlockResponses(); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetBlockResponse(RuleConnLimit, ""); got != BlockRST {
+		t.Errorf("GetBlockResponse with default=rst = %q", got)
+	}
+}
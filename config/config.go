@@ -41,16 +41,6 @@ var (
 	ja4Blacklist        = make(map[string]bool)
 	ja4Whitelist        = make(map[string]bool)
 
-	// blockedCounter 存储每个 JA3 阻止的事件计数，map[ja3]map[timeStr]count
-	ja3blockedCounter   = make(map[string]map[string]int)
-	ja3blockedCounterMu sync.Mutex
-
-	ja3nblockedCounter   = make(map[string]map[string]int)
-	ja3nblockedCounterMu sync.Mutex
-
-	ja4blockedCounter   = make(map[string]map[string]int)
-	ja4blockedCounterMu sync.Mutex
-
 	// 内存中缓存上报的计数（按指纹字符串累加）
 	ja3ReportCounter = make(map[string]int)
 	ja3ReportMu      sync.Mutex
@@ -90,12 +80,16 @@ func Init(redisAddr, redisPasswd string, dbNum int) {
 func refreshConfigLoop() {
 	for {
 		if redisAvailable {
+			start := time.Now()
 			err := refreshFlags()
 			err2 := refreshLists()
+			redisRefreshSeconds.With().Observe(time.Since(start).Seconds())
 			if err != nil || err2 != nil {
+				redisRefreshTotal.With("error").Inc()
 				slog.Warn("[WARN] Redis 刷新配置失败，保持当前状态")
 				redisAvailable = false
 			} else {
+				redisRefreshTotal.With("ok").Inc()
 				// 启动清理任务（只启动一次）
 				cleanupOnce.Do(func() {
 					slog.Info("[INFO] 启动定时清理任务")
@@ -104,6 +98,8 @@ func refreshConfigLoop() {
 					startBlockedAggregation()
 					slog.Info("[INFO] 启动上报任务")
 					scheduleReportFlush()
+					slog.Info("[INFO] 启动事件流写入任务")
+					startEventStream()
 				})
 			}
 		} else {
@@ -151,6 +147,22 @@ func refreshFlags() error {
 	enableJA4Whitelist = _enableJA4Whitelist
 	enableJA4Collection = _enableJA4Collection
 	mu.Unlock()
+
+	refreshSurgeFlags()
+	refreshRateLimitFlags()
+	refreshConnLimitFlags()
+	refreshIPFlags()
+	refreshHandshakeFlags()
+	refreshFirstFlightFlags()
+	refreshRelayFlags()
+	refreshTarpitFlags()
+	refreshLBFlags()
+	refreshMetricsFlags()
+	refreshAccessLogFlags()
+	refreshEventFlags()
+	refreshSeriesFlags()
+	refreshNewFPFlags()
+	refreshEgressFlags()
 	return err
 }
 
@@ -168,6 +180,42 @@ func getBool(key string, defaultVal bool) (bool, error) {
 	return val == "true", nil
 }
 
+// getInt 读取整数配置，键不存在时写入默认值
+func getInt(key string, defaultVal int64) (int64, error) {
+	val, err := rdb.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			rdb.Set(ctx, key, defaultVal, 0)
+		}
+		return defaultVal, err
+	}
+	return val, nil
+}
+
+// getString 读取字符串配置，键不存在时写入默认值
+func getString(key string, defaultVal string) (string, error) {
+	val, err := rdb.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			rdb.Set(ctx, key, defaultVal, 0)
+		}
+		return defaultVal, err
+	}
+	return val, nil
+}
+
+// getFloat 读取浮点数配置，键不存在时写入默认值
+func getFloat(key string, defaultVal float64) (float64, error) {
+	val, err := rdb.Get(ctx, key).Float64()
+	if err != nil {
+		if err == redis.Nil {
+			rdb.Set(ctx, key, defaultVal, 0)
+		}
+		return defaultVal, err
+	}
+	return val, nil
+}
+
 func refreshLists() error {
 
 	var err error
@@ -187,6 +235,19 @@ func refreshLists() error {
 	ja4Whitelist = _ja4Whitelist
 	mu.Unlock()
 
+	if err := refreshIPLists(); err != nil {
+		slog.Warn("[WARN] 加载 IP 黑白名单失败", "err", err)
+	}
+	if err := refreshTempBlocks(); err != nil {
+		slog.Warn("[WARN] 加载临时封禁列表失败", "err", err)
+	}
+	if err := refreshBlockResponses(); err != nil {
+		slog.Warn("[WARN] 加载阻止响应配置失败", "err", err)
+	}
+	if err := refreshUpstreamPool(); err != nil {
+		slog.Warn("[WARN] 加载上游池失败", "err", err)
+	}
+
 	return err
 }
 
@@ -213,6 +274,10 @@ func EnableJA4Collection() bool  { mu.RLock(); defer mu.RUnlock(); return enable
 func ShouldBlockJA3(ja3 string) bool {
 	mu.RLock()
 	defer mu.RUnlock()
+	// 临时封禁（包括突增自动封禁）不受 ja3_check_enabled 控制，与 IP 临时封禁一致
+	if tempBlockedLocked(KindJA3, ja3) {
+		return true
+	}
 	if !enableJA3Check {
 		return false
 	}
@@ -228,6 +293,10 @@ func ShouldBlockJA3(ja3 string) bool {
 func ShouldBlockJA3N(ja3n string) bool {
 	mu.RLock()
 	defer mu.RUnlock()
+	// 临时封禁（包括突增自动封禁）不受 ja3n_check_enabled 控制，与 IP 临时封禁一致
+	if tempBlockedLocked(KindJA3N, ja3n) {
+		return true
+	}
 	if !enableJA3NCheck {
 		return false
 	}
@@ -243,6 +312,10 @@ func ShouldBlockJA3N(ja3n string) bool {
 func ShouldBlockJA4(ja4 string) bool {
 	mu.RLock()
 	defer mu.RUnlock()
+	// 临时封禁（包括突增自动封禁）不受 ja4_check_enabled 控制，与 IP 临时封禁一致
+	if tempBlockedLocked(KindJA4, ja4) {
+		return true
+	}
 	if !enableJA4Check {
 		return false
 	}
@@ -255,98 +328,94 @@ func ShouldBlockJA4(ja4 string) bool {
 	return false
 }
 
-// ReportJA3 仅记录到内存中，不直接调用 Redis
-func ReportJA3(ja3 string) {
+// ReportJA3 仅记录到内存中，不直接调用 Redis；sample 用于估算指纹的不同客户端数并记录首次出现的样本
+func ReportJA3(ja3 string, sample ClientSample) {
 	if !redisAvailable || !enableJA3Collection {
 		return
 	}
 	ja3ReportMu.Lock()
 	ja3ReportCounter[ja3]++
 	ja3ReportMu.Unlock()
+	fingerprintReports[KindJA3].add(ja3, sample)
 }
 
 // ReportJA3N 同理
-func ReportJA3N(ja3n string) {
+func ReportJA3N(ja3n string, sample ClientSample) {
 	if !redisAvailable || !enableJA3NCollection {
 		return
 	}
 	ja3nReportMu.Lock()
 	ja3nReportCounter[ja3n]++
 	ja3nReportMu.Unlock()
+	fingerprintReports[KindJA3N].add(ja3n, sample)
 }
 
 // ReportJA4 同理
-func ReportJA4(ja4 string) {
+func ReportJA4(ja4 string, sample ClientSample) {
 	if !redisAvailable || !enableJA4Collection {
 		return
 	}
 	ja4ReportMu.Lock()
 	ja4ReportCounter[ja4]++
 	ja4ReportMu.Unlock()
+	fingerprintReports[KindJA4].add(ja4, sample)
 }
 
 // flushReports 将内存中记录的上报数据一次性批量写入 Redis，并清空缓存
 func flushReports() {
-	now := float64(time.Now().Unix())
+	t := time.Now()
 
 	// 处理 JA3
 	ja3ReportMu.Lock()
 	tmpJA3 := ja3ReportCounter
 	ja3ReportCounter = make(map[string]int)
 	ja3ReportMu.Unlock()
-
-	go func(tmpJA3 map[string]int) {
-		if len(tmpJA3) > 0 {
-			pipe := rdb.TxPipeline()
-			for fp, count := range tmpJA3 {
-				pipe.ZIncrBy(ctx, "ja3:count", float64(count), fp)
-				pipe.ZAdd(ctx, "ja3:last_seen", redis.Z{Score: now, Member: fp})
-				pipe.SAdd(ctx, "ja3:collected", fp)
-			}
-			if _, err := pipe.Exec(ctx); err != nil {
-				slog.Warn("[WARN] Redis 上报 JA3 失败", "err", err)
-			}
-		}
-	}(tmpJA3)
+	go flushFingerprintReports(KindJA3, tmpJA3, fingerprintReports[KindJA3].take(), t)
 
 	// 处理 JA3N
 	ja3nReportMu.Lock()
 	tmpJA3N := ja3nReportCounter
 	ja3nReportCounter = make(map[string]int)
 	ja3nReportMu.Unlock()
-
-	go func(tmpJA3N map[string]int) {
-		if len(tmpJA3N) > 0 {
-			pipe := rdb.TxPipeline()
-			for fp, count := range tmpJA3N {
-				pipe.ZIncrBy(ctx, "ja3n:count", float64(count), fp)
-				pipe.ZAdd(ctx, "ja3n:last_seen", redis.Z{Score: now, Member: fp})
-				pipe.SAdd(ctx, "ja3n:collected", fp)
-			}
-			if _, err := pipe.Exec(ctx); err != nil {
-				slog.Warn("[WARN] Redis 上报 JA3N 失败", "err", err)
-			}
-		}
-	}(tmpJA3N)
+	go flushFingerprintReports(KindJA3N, tmpJA3N, fingerprintReports[KindJA3N].take(), t)
 
 	// 处理 JA4
 	ja4ReportMu.Lock()
 	tmpJA4 := ja4ReportCounter
 	ja4ReportCounter = make(map[string]int)
 	ja4ReportMu.Unlock()
-	go func(tmpJA4 map[string]int) {
-		if len(tmpJA4) > 0 {
-			pipe := rdb.TxPipeline()
-			for fp, count := range tmpJA4 {
-				pipe.ZIncrBy(ctx, "ja4:count", float64(count), fp)
-				pipe.ZAdd(ctx, "ja4:last_seen", redis.Z{Score: now, Member: fp})
-				pipe.SAdd(ctx, "ja4:collected", fp)
-			}
-			if _, err := pipe.Exec(ctx); err != nil {
-				slog.Warn("[WARN] Redis 上报 JA4 失败", "err", err)
-			}
+	go flushFingerprintReports(KindJA4, tmpJA4, fingerprintReports[KindJA4].take(), t)
+
+	go flushEgressReports(float64(t.Unix()))
+	go flushECHReports()
+}
+
+// flushFingerprintReports 写入一种指纹在一个上报周期内的计数、最后出现时间、分桶计数与 HyperLogLog，
+// 并处理首次出现的指纹
+func flushFingerprintReports(kind string, counts map[string]int, data fingerprintReportData, t time.Time) {
+	detectSurge(kind, counts)
+	if len(counts) == 0 {
+		return
+	}
+	now := float64(t.Unix())
+	results := make(map[string]firstSeenResult, len(counts))
+	pipe := rdb.TxPipeline()
+	for fp, count := range counts {
+		results[fp] = firstSeenResult{
+			hits:      pipe.ZIncrBy(ctx, kind+":count", float64(count), fp),
+			added:     pipe.ZAddNX(ctx, kind+":first_seen", redis.Z{Score: now, Member: fp}),
+			firstSeen: pipe.ZScore(ctx, kind+":first_seen", fp),
 		}
-	}(tmpJA4)
+		pipe.ZAdd(ctx, kind+":last_seen", redis.Z{Score: now, Member: fp})
+		pipe.SAdd(ctx, kind+":collected", fp)
+		addSeries(pipe, kind, SeriesCollected, fp, t, int64(count))
+	}
+	addUnique(pipe, kind, data.ips, data.snis)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] Redis 上报指纹失败", "kind", kind, "err", err)
+		return
+	}
+	handleFirstSeen(kind, counts, results, data.samples, t)
 }
 
 // scheduleReportFlush 每隔 5 秒批量上报一次上报数据（确保只启动一次）
@@ -374,6 +443,24 @@ func CleanupOldFingerprintEntries(expireSeconds int64) {
 		"ja3:last_seen",
 		"ja3n:last_seen",
 		"ja4:last_seen",
+		"egress:last_seen",
+	}
+
+	// 过期指纹的 HyperLogLog 随 last_seen 一起删除
+	for _, kind := range []string{KindJA3, KindJA3N, KindJA4} {
+		expired, err := rdb.ZRangeByScore(ctx, kind+":last_seen", &redis.ZRangeBy{Min: "-inf", Max: expireScore}).Result()
+		if err != nil {
+			slog.Warn("[WARN] 读取过期指纹失败", "kind", kind, "err", err)
+			continue
+		}
+		deleteUnique(kind, expired)
+	}
+
+	// 不再出现的源主机的出站指纹记录随 egress:last_seen 一起删除
+	if expired, err := rdb.ZRangeByScore(ctx, "egress:last_seen", &redis.ZRangeBy{Min: "-inf", Max: expireScore}).Result(); err != nil {
+		slog.Warn("[WARN] 读取过期源主机失败", "err", err)
+	} else {
+		deleteEgressHosts(expired)
 	}
 
 	for _, key := range targets {
@@ -383,6 +470,11 @@ func CleanupOldFingerprintEntries(expireSeconds int64) {
 			slog.Info("[INFO] 清理指纹过期项", "key", key, "deleted", deleted)
 		}
 	}
+
+	// 首次出现记录有单独的保留时长
+	for _, kind := range []string{KindJA3, KindJA3N, KindJA4} {
+		cleanupFirstSeen(kind)
+	}
 }
 
 func scheduleCleanup() {
@@ -395,129 +487,26 @@ func scheduleCleanup() {
 	}()
 }
 
-// ReportBlockedEvent 被阻止时调用，记录指纹阻止事件。
+// ReportJA3BlockedEvent 被阻止时调用，按分钟累加到阻止计数的序列中
 func ReportJA3BlockedEvent(ja3 string) {
-	// 获取当前时间的秒数表示，例如 "15:04:05"
-	now := time.Now().Format("2006-01-02 15:04:05")
-
-	ja3blockedCounterMu.Lock()
-	defer ja3blockedCounterMu.Unlock()
-
-	if _, exists := ja3blockedCounter[ja3]; !exists {
-		ja3blockedCounter[ja3] = make(map[string]int)
-	}
-	ja3blockedCounter[ja3][now]++
+	recordSeries(KindJA3, SeriesBlocked, ja3, 1)
 }
 
 func ReportJA3NBlockedEvent(ja3n string) {
-	// 获取当前时间的秒数表示，例如 "15:04:05"
-	now := time.Now().Format("2006-01-02 15:04:05")
-
-	ja3nblockedCounterMu.Lock()
-	defer ja3nblockedCounterMu.Unlock()
-
-	if _, exists := ja3nblockedCounter[ja3n]; !exists {
-		ja3nblockedCounter[ja3n] = make(map[string]int)
-	}
-	ja3nblockedCounter[ja3n][now]++
+	recordSeries(KindJA3N, SeriesBlocked, ja3n, 1)
 }
 
 func ReportJA4BlockedEvent(ja4 string) {
-	// 获取当前时间的秒数表示，例如 "15:04:05"
-	now := time.Now().Format("2006-01-02 15:04:05")
-
-	ja4blockedCounterMu.Lock()
-	defer ja4blockedCounterMu.Unlock()
-
-	if _, exists := ja4blockedCounter[ja4]; !exists {
-		ja4blockedCounter[ja4] = make(map[string]int)
-	}
-	ja4blockedCounter[ja4][now]++
+	recordSeries(KindJA4, SeriesBlocked, ja4, 1)
 }
 
-// startBlockedAggregation 启动定时任务，每隔30秒上报 blockedCounter 数据到 Redis
+// startBlockedAggregation 启动定时任务，每隔30秒上报分桶计数与统计数据到 Redis
 func startBlockedAggregation() {
 	ticker := time.NewTicker(30 * time.Second)
 	go func() {
 		for range ticker.C {
-			flushJA3BlockedCounters()
-			flushJA3NBlockedCounters()
-			flushJA4BlockedCounters()
+			flushSeries()
+			flushStats()
 		}
 	}()
 }
-
-// flushBlockedCounters 将 blockedCounter 数据写入 Redis，并清空内存中已统计的数据
-func flushJA3BlockedCounters() {
-	ja3blockedCounterMu.Lock()
-	// 备份当前数据，并重置全局计数
-	data := ja3blockedCounter
-	ja3blockedCounter = make(map[string]map[string]int)
-	ja3blockedCounterMu.Unlock()
-
-	// 对每个 ja3，将对应数据上报到 Redis 哈希结构中
-	for ja3, timeMap := range data {
-		redisKey := fmt.Sprintf("ja3:blocked:%s", ja3)
-		pipe := rdb.TxPipeline()
-		for tStr, count := range timeMap {
-			// 使用 HINCRBY 方法更新字段，便于多个周期累加
-			pipe.HIncrBy(ctx, redisKey, tStr, int64(count))
-		}
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			slog.Warn("[WARN] 上报 JA3 阻止计数失败", "ja3", ja3, "err", err)
-		} else {
-			slog.Info("[INFO] 上报 JA3 阻止计数", "ja3", ja3, "timeMap", timeMap)
-		}
-	}
-}
-
-// flushBlockedCounters 将 blockedCounter 数据写入 Redis，并清空内存中已统计的数据
-func flushJA3NBlockedCounters() {
-	ja3nblockedCounterMu.Lock()
-	// 备份当前数据，并重置全局计数
-	data := ja3nblockedCounter
-	ja3nblockedCounter = make(map[string]map[string]int)
-	ja3nblockedCounterMu.Unlock()
-
-	// 对每个 ja3，将对应数据上报到 Redis 哈希结构中
-	for ja3, timeMap := range data {
-		redisKey := fmt.Sprintf("ja3n:blocked:%s", ja3)
-		pipe := rdb.TxPipeline()
-		for tStr, count := range timeMap {
-			// 使用 HINCRBY 方法更新字段，便于多个周期累加
-			pipe.HIncrBy(ctx, redisKey, tStr, int64(count))
-		}
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			slog.Warn("[WARN] 上报 JA3N 阻止计数失败", "ja3", ja3, "err", err)
-		} else {
-			slog.Info("[INFO] 上报 JA3N 阻止计数", "ja3", ja3, "timeMap", timeMap)
-		}
-	}
-}
-
-// flushBlockedCounters 将 blockedCounter 数据写入 Redis，并清空内存中已统计的数据
-func flushJA4BlockedCounters() {
-	ja4blockedCounterMu.Lock()
-	// 备份当前数据，并重置全局计数
-	data := ja4blockedCounter
-	ja4blockedCounter = make(map[string]map[string]int)
-	ja4blockedCounterMu.Unlock()
-
-	// 对每个 ja3，将对应数据上报到 Redis 哈希结构中
-	for ja3, timeMap := range data {
-		redisKey := fmt.Sprintf("ja4:blocked:%s", ja3)
-		pipe := rdb.TxPipeline()
-		for tStr, count := range timeMap {
-			// 使用 HINCRBY 方法更新字段，便于多个周期累加
-			pipe.HIncrBy(ctx, redisKey, tStr, int64(count))
-		}
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			slog.Warn("[WARN] 上报 JA4 阻止计数失败", "ja3", ja3, "err", err)
-		} else {
-			slog.Info("[INFO] 上报 JA4 阻止计数", "ja3", ja3, "timeMap", timeMap)
-		}
-	}
-}
@@ -0,0 +1,37 @@
+package config
+
+// 并发连接数限制，0 表示不限制
+var connLimits = ConnLimits{
+	PrefixV4: 24,
+	PrefixV6: 64,
+}
+
+// ConnLimits 为并发连接数上限配置
+type ConnLimits struct {
+	PerIP          int64 // 单个客户端 IP
+	PerPrefix      int64 // 同一网段（IPv4 按 PrefixV4、IPv6 按 PrefixV6 聚合）
+	PerFingerprint int64 // 同一指纹（优先 JA4，未计算时使用 JA3N）
+	PrefixV4       int
+	PrefixV6       int
+}
+
+func refreshConnLimitFlags() {
+	_perIP, _ := getInt("config:connlimit_per_ip", connLimits.PerIP)
+	_perPrefix, _ := getInt("config:connlimit_per_prefix", connLimits.PerPrefix)
+	_perFingerprint, _ := getInt("config:connlimit_per_fp", connLimits.PerFingerprint)
+	_prefixV4, _ := getInt("config:connlimit_prefix_v4", int64(connLimits.PrefixV4))
+	_prefixV6, _ := getInt("config:connlimit_prefix_v6", int64(connLimits.PrefixV6))
+
+	mu.Lock()
+	connLimits = ConnLimits{
+		PerIP:          _perIP,
+		PerPrefix:      _perPrefix,
+		PerFingerprint: _perFingerprint,
+		PrefixV4:       int(min(max(_prefixV4, 0), 32)),
+		PrefixV6:       int(min(max(_prefixV6, 0), 128)),
+	}
+	mu.Unlock()
+}
+
+// GetConnLimits 返回当前的并发连接数上限配置
+func GetConnLimits() ConnLimits { mu.RLock(); defer mu.RUnlock(); return connLimits }
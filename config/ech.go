@@ -0,0 +1,41 @@
+package config
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// 携带 ECH 扩展的连接按指纹计数，随上报任务写入有序集合 <kind>:ech_count，
+// 与 <kind>:count 对比可得到某个指纹使用 ECH 的比例
+var (
+	echReportCounter = make(map[[2]string]int)
+	echReportMu      sync.Mutex
+)
+
+// ReportECH 记录一次携带 ECH 扩展的连接，仅记录到内存中
+func ReportECH(kind, fp string) {
+	if !redisAvailable || fp == "" {
+		return
+	}
+	echReportMu.Lock()
+	echReportCounter[[2]string{kind, fp}]++
+	echReportMu.Unlock()
+}
+
+func flushECHReports() {
+	echReportMu.Lock()
+	data := echReportCounter
+	echReportCounter = make(map[[2]string]int)
+	echReportMu.Unlock()
+
+	if len(data) == 0 {
+		return
+	}
+	pipe := rdb.TxPipeline()
+	for k, count := range data {
+		pipe.ZIncrBy(ctx, k[0]+":ech_count", float64(count), k[1])
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] Redis 上报 ECH 计数失败", "err", err)
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"tls-proxy/util"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 正向代理的出站目标策略，防止被当作开放代理访问内网：
+//   - config:egress_allowed_ports 允许的目标端口，逗号分隔，* 表示不限制，默认 443
+//   - config:egress_denied_cidrs 额外禁止的目标网段，逗号分隔，默认为空
+//   - config:egress_allow_private 是否允许回环、私有、链路本地（含云元数据 169.254.169.254）、
+//     未指定与组播地址，默认 false
+//   - config:egress_allow_non_tls 隧道内首包不是可解析的 TLS ClientHello 时是否放行，默认 false
+//
+// 目标为域名时在连接上游时按解析出的地址检查
+const defaultEgressAllowedPorts = "443"
+
+var (
+	egressAllowedPorts = map[string]bool{"443": true} // nil 表示不限制
+	egressDeniedCIDRs  *util.IPTrie
+	egressAllowPrivate = false
+	egressAllowNonTLS  = false
+)
+
+// 正向代理模式下按内网源主机记录指纹，随上报任务批量写入：
+//   - 有序集合 <kind>:egress:host:<ip>，成员为指纹，分数为连接次数
+//   - 有序集合 <kind>:egress:fp:<fp>，成员为源主机 IP，分数为连接次数
+//   - 有序集合 egress:last_seen，成员为源主机 IP，分数为最后出现时间
+//
+// 不再出现的源主机由 CleanupOldFingerprintEntries 随 egress:last_seen 一起清理
+type egressKey struct {
+	kind string
+	ip   string
+	fp   string
+}
+
+var (
+	egressReportCounter = make(map[egressKey]int)
+	egressReportMu      sync.Mutex
+)
+
+// ReportEgress 记录内网源主机使用的指纹，仅记录到内存中
+func ReportEgress(kind, ip, fp string) {
+	if !redisAvailable || fp == "" {
+		return
+	}
+	egressReportMu.Lock()
+	egressReportCounter[egressKey{kind: kind, ip: ip, fp: fp}]++
+	egressReportMu.Unlock()
+}
+
+func flushEgressReports(now float64) {
+	egressReportMu.Lock()
+	data := egressReportCounter
+	egressReportCounter = make(map[egressKey]int)
+	egressReportMu.Unlock()
+
+	if len(data) == 0 {
+		return
+	}
+	pipe := rdb.TxPipeline()
+	for k, count := range data {
+		pipe.ZIncrBy(ctx, k.kind+":egress:host:"+k.ip, float64(count), k.fp)
+		pipe.ZIncrBy(ctx, k.kind+":egress:fp:"+k.fp, float64(count), k.ip)
+		pipe.ZAdd(ctx, "egress:last_seen", redis.Z{Score: now, Member: k.ip})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] Redis 上报出站指纹失败", "err", err)
+	}
+}
+
+// deleteEgressHosts 删除源主机的 <kind>:egress:host:<ip>，并从其用过的指纹的 <kind>:egress:fp:<fp> 中移除该主机，
+// 移除后为空的有序集合由 Redis 自动删除
+func deleteEgressHosts(ips []string) {
+	if len(ips) == 0 {
+		return
+	}
+	kinds := []string{KindJA3, KindJA3N, KindJA4}
+	pipe := rdb.Pipeline()
+	fps := make(map[egressKey]*redis.StringSliceCmd, len(ips)*len(kinds))
+	for _, kind := range kinds {
+		for _, ip := range ips {
+			fps[egressKey{kind: kind, ip: ip}] = pipe.ZRange(ctx, kind+":egress:host:"+ip, 0, -1)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		slog.Warn("[WARN] 读取源主机出站指纹失败", "hosts", len(ips), "err", err)
+		return
+	}
+
+	pipe = rdb.Pipeline()
+	for k, cmd := range fps {
+		for _, fp := range cmd.Val() {
+			pipe.ZRem(ctx, k.kind+":egress:fp:"+fp, k.ip)
+		}
+		pipe.Del(ctx, k.kind+":egress:host:"+k.ip)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 清理源主机出站指纹失败", "hosts", len(ips), "err", err)
+	}
+}
+
+func refreshEgressFlags() {
+	_ports, _ := getString("config:egress_allowed_ports", defaultEgressAllowedPorts)
+	_cidrs, _ := getOptionalString("config:egress_denied_cidrs")
+	_allowPrivate, _ := getBool("config:egress_allow_private", egressAllowPrivate)
+	_allowNonTLS, _ := getBool("config:egress_allow_non_tls", egressAllowNonTLS)
+
+	var _allowedPorts map[string]bool
+	if strings.TrimSpace(_ports) != "*" {
+		_allowedPorts = make(map[string]bool)
+		for _, port := range strings.Split(_ports, ",") {
+			if port = strings.TrimSpace(port); port != "" {
+				_allowedPorts[port] = true
+			}
+		}
+	}
+	_deniedCIDRs := util.NewIPTrie()
+	for _, v := range strings.Split(_cidrs, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		p, err := util.ParsePrefix(v)
+		if err != nil {
+			slog.Warn("[WARN] 忽略无效的出站禁止网段", "value", v, "err", err)
+			continue
+		}
+		_deniedCIDRs.Insert(p)
+	}
+
+	mu.Lock()
+	egressAllowedPorts = _allowedPorts
+	egressDeniedCIDRs = _deniedCIDRs
+	egressAllowPrivate = _allowPrivate
+	egressAllowNonTLS = _allowNonTLS
+	mu.Unlock()
+}
+
+// EgressPortAllowed 判断正向代理是否允许连接该目标端口
+func EgressPortAllowed(port string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return egressAllowedPorts == nil || egressAllowedPorts[port]
+}
+
+// EgressAddrAllowed 判断正向代理是否允许连接该目标地址
+func EgressAddrAllowed(addr netip.Addr) bool {
+	mu.RLock()
+	allowPrivate, denied := egressAllowPrivate, egressDeniedCIDRs
+	mu.RUnlock()
+
+	addr = addr.Unmap()
+	if !allowPrivate && (addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsUnspecified() || addr.IsMulticast()) {
+		return false
+	}
+	return !denied.Contains(addr)
+}
+
+// EgressAllowNonTLS 判断正向代理是否放行隧道内的非 TLS 首包
+func EgressAllowNonTLS() bool { mu.RLock(); defer mu.RUnlock(); return egressAllowNonTLS }
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCleanupEgressHosts(t *testing.T) {
+	s := useTestRedis(t)
+
+	ReportEgress(KindJA4, "10.0.0.1", "fp-a")
+	ReportEgress(KindJA4, "10.0.0.2", "fp-a")
+	ReportEgress(KindJA3, "10.0.0.1", "fp-b")
+	flushEgressReports(float64(time.Now().Add(-24 * time.Hour).Unix()))
+	// 10.0.0.2 最近仍然出现
+	rdb.ZAdd(ctx, "egress:last_seen", redis.Z{Score: float64(time.Now().Unix()), Member: "10.0.0.2"})
+
+	CleanupOldFingerprintEntries(3600)
+
+	for _, key := range []string{"ja4:egress:host:10.0.0.1", "ja3:egress:host:10.0.0.1", "ja3:egress:fp:fp-b"} {
+		if s.Exists(key) {
+			t.Errorf("%s should be deleted", key)
+		}
+	}
+	if members, _ := s.ZMembers("ja4:egress:fp:fp-a"); len(members) != 1 || members[0] != "10.0.0.2" {
+		t.Errorf("ja4:egress:fp:fp-a = %v, want [10.0.0.2]", members)
+	}
+	if !s.Exists("ja4:egress:host:10.0.0.2") {
+		t.Error("ja4:egress:host:10.0.0.2 should be kept")
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 事件类型
+const (
+	EventBlock     = "block"
+	EventRateLimit = "ratelimit"
+	EventDivert    = "divert"
+	EventCount     = "count"
+)
+
+// 阻止、限速、分流与计数的连接逐条追加到 Redis Stream events:stream，
+// 长度按 MAXLEN ~ 近似裁剪，可以用消费者组（XREADGROUP）读取
+const eventStreamKey = "events:stream"
+
+const (
+	eventQueueSize = 4096
+	eventBatchSize = 256 // 每个 pipeline 最多写入的事件数
+
+	// minEventStreamMaxLen 为事件流长度上限的最小值；MAXLEN 为 0 时 go-redis 不裁剪，事件流会无限增长
+	minEventStreamMaxLen = 1000
+)
+
+var (
+	enableEventStream       = true
+	eventStreamMaxLen int64 = 100000
+
+	eventQueue = make(chan Event, eventQueueSize)
+)
+
+// Event 为一条连接事件，字段为空时同样写入，便于消费端按固定字段解析
+type Event struct {
+	Time       time.Time
+	Type       string // 见 EventBlock 等
+	Rule       string // 命中的规则：ip、ja3、ja3n、ja4、firstflight、ratelimit、connlimit
+	Action     string // 阻止时为响应方式，分流时为 divert
+	Value      string // 命中的 IP、指纹、首包分类或限速键
+	ClientIP   string
+	ClientPort string
+	Listener   string
+	SNI        string
+	ALPN       []string
+	ECH        bool
+	JA3        string
+	JA3N       string
+	JA4        string
+	Target     string // 分流目标或透明代理的原始目标地址
+}
+
+func refreshEventFlags() {
+	_enableEventStream, _ := getBool("config:event_stream_enabled", enableEventStream)
+	_eventStreamMaxLen, _ := getInt("config:event_stream_maxlen", eventStreamMaxLen)
+	if _eventStreamMaxLen < minEventStreamMaxLen {
+		slog.Warn("[WARN] 事件流长度上限过小，使用最小值", "maxlen", _eventStreamMaxLen, "min", minEventStreamMaxLen)
+		_eventStreamMaxLen = minEventStreamMaxLen
+	}
+
+	mu.Lock()
+	enableEventStream = _enableEventStream
+	eventStreamMaxLen = _eventStreamMaxLen
+	mu.Unlock()
+}
+
+// ReportEvent 记录一条连接事件，由后台任务批量写入事件流；队列已满时丢弃
+func ReportEvent(ev Event) {
+	mu.RLock()
+	enabled := enableEventStream
+	mu.RUnlock()
+	if !redisAvailable || !enabled {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case eventQueue <- ev:
+	default:
+		IncrStat("events:dropped")
+	}
+}
+
+// startEventStream 启动事件流写入任务，队列中积压的事件合并到同一个 pipeline 中写入
+func startEventStream() {
+	go func() {
+		batch := make([]Event, 0, eventBatchSize)
+		for ev := range eventQueue {
+			batch = append(batch[:0], ev)
+		drain:
+			for len(batch) < eventBatchSize {
+				select {
+				case ev := <-eventQueue:
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			flushEvents(batch)
+		}
+	}()
+}
+
+func flushEvents(batch []Event) {
+	mu.RLock()
+	maxLen := eventStreamMaxLen
+	mu.RUnlock()
+
+	pipe := rdb.Pipeline()
+	for _, ev := range batch {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: eventStreamKey,
+			MaxLen: maxLen,
+			Approx: true,
+			Values: ev.values(),
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] Redis 写入事件流失败", "events", len(batch), "err", err)
+	}
+}
+
+// values 返回写入事件流的字段，按固定顺序排列
+func (ev *Event) values() []interface{} {
+	return []interface{}{
+		"ts", strconv.FormatInt(ev.Time.UnixMilli(), 10),
+		"type", ev.Type,
+		"rule", ev.Rule,
+		"action", ev.Action,
+		"value", ev.Value,
+		"ip", ev.ClientIP,
+		"port", ev.ClientPort,
+		"listener", ev.Listener,
+		"sni", ev.SNI,
+		"alpn", strings.Join(ev.ALPN, ","),
+		"ech", strconv.FormatBool(ev.ECH),
+		"ja3", ev.JA3,
+		"ja3n", ev.JA3N,
+		"ja4", ev.JA4,
+		"target", ev.Target,
+	}
+}
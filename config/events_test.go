@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventStreamMaxLen(t *testing.T) {
+	s := useTestRedis(t)
+	mu.RLock()
+	old := eventStreamMaxLen
+	mu.RUnlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		eventStreamMaxLen = old
+		mu.Unlock()
+	})
+
+	// 0 或负数会关闭裁剪，应提升到最小值
+	for _, v := range []string{"0", "-5"} {
+		s.Set("config:event_stream_maxlen", v)
+		refreshEventFlags()
+		mu.RLock()
+		got := eventStreamMaxLen
+		mu.RUnlock()
+		if got != minEventStreamMaxLen {
+			t.Errorf("maxlen %s: got %d, want %d", v, got, minEventStreamMaxLen)
+		}
+	}
+
+	flushEvents([]Event{{Time: time.Unix(1700000000, 0), Type: EventBlock, Rule: KindJA4, ALPN: []string{"h2"}}})
+	msgs, err := rdb.XRange(ctx, eventStreamKey, "-", "+").Result()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("XRANGE = %v, %v", msgs, err)
+	}
+	if v := msgs[0].Values; v["type"] != EventBlock || v["rule"] != KindJA4 || v["alpn"] != "h2" || v["ts"] != "1700000000000" {
+		t.Errorf("event values = %v", v)
+	}
+}
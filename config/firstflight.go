@@ -0,0 +1,134 @@
+package config
+
+import "sync"
+
+// 首包分类：无法提取指纹或需要单独处理的客户端首包
+const (
+	FlightNonTLS    = "nontls"    // 非 TLS 流量
+	FlightMalformed = "malformed" // TLS 记录头正确，但 ClientHello 无法解析
+	FlightSSLv2     = "sslv2"     // SSLv2 兼容格式的 ClientHello
+	FlightECH       = "ech"       // 携带 ECH 扩展的 ClientHello：照常计算指纹，SNI 为外层公开名称
+)
+
+// 注意：Chrome 与 Firefox 在没有 ECH 配置时也会发送 GREASE ECH 扩展，外层与真实 ECH 无法区分，
+// 因此 ech 分类几乎覆盖所有现代浏览器的连接。ech_policy 设为 block 或 divert 会作用于这些浏览器的全部流量，
+// 只想处理部分客户端时应使用指纹黑名单，<kind>:ech_count 中按指纹记录的 ECH 次数可用于筛选
+
+// 首包处理策略
+const (
+	PolicyForward = "forward" // 直接转发
+	PolicyBlock   = "block"   // 断开连接
+	PolicyDivert  = "divert"  // 转发到另一个上游（divert_target）
+	PolicyCount   = "count"   // 记录日志后转发
+)
+
+var flightClasses = []string{FlightNonTLS, FlightMalformed, FlightSSLv2, FlightECH}
+
+// FirstFlightPolicy 为某一类首包的处理策略
+type FirstFlightPolicy struct {
+	Action       string
+	DivertTarget string
+}
+
+var (
+	// 全局策略：config:<分类>_policy、config:divert_target
+	// 监听器策略：config:listener:<端口>:<分类>_policy、config:listener:<端口>:divert_target，未设置时使用全局策略
+	firstFlightPolicies = map[string]string{
+		FlightNonTLS:    PolicyForward,
+		FlightMalformed: PolicyForward,
+		FlightSSLv2:     PolicyForward,
+		FlightECH:       PolicyForward,
+	}
+	divertTarget = ""
+
+	listenerPolicies     = make(map[string]map[string]string)
+	listenerDivertTarget = make(map[string]string)
+
+	listenerNames   []string
+	listenerNamesMu sync.Mutex
+)
+
+// SetListeners 登记监听器名称（端口），用于加载监听器级别的配置
+func SetListeners(names []string) {
+	listenerNamesMu.Lock()
+	listenerNames = append([]string(nil), names...)
+	listenerNamesMu.Unlock()
+}
+
+// getOptionalString 读取可选配置，键不存在时不写入默认值
+func getOptionalString(key string) (string, bool) {
+	val, err := rdb.Get(ctx, key).Result()
+	if err != nil || val == "" {
+		return "", false
+	}
+	return val, true
+}
+
+func refreshFirstFlightFlags() {
+	_policies := make(map[string]string, len(flightClasses))
+	for _, class := range flightClasses {
+		mu.RLock()
+		def := firstFlightPolicies[class]
+		mu.RUnlock()
+		_policies[class], _ = getString("config:"+class+"_policy", def)
+	}
+	_divertTarget, _ := getString("config:divert_target", divertTarget)
+
+	listenerNamesMu.Lock()
+	names := listenerNames
+	listenerNamesMu.Unlock()
+
+	_listenerPolicies := make(map[string]map[string]string, len(names))
+	_listenerDivertTarget := make(map[string]string, len(names))
+	for _, name := range names {
+		prefix := "config:listener:" + name + ":"
+		for _, class := range flightClasses {
+			if v, ok := getOptionalString(prefix + class + "_policy"); ok {
+				if _listenerPolicies[name] == nil {
+					_listenerPolicies[name] = make(map[string]string)
+				}
+				_listenerPolicies[name][class] = v
+			}
+		}
+		if v, ok := getOptionalString(prefix + "divert_target"); ok {
+			_listenerDivertTarget[name] = v
+		}
+	}
+
+	mu.Lock()
+	firstFlightPolicies = _policies
+	divertTarget = _divertTarget
+	listenerPolicies = _listenerPolicies
+	listenerDivertTarget = _listenerDivertTarget
+	mu.Unlock()
+}
+
+// GetFirstFlightPolicy 返回监听器上某一类首包的处理策略。
+// divert 策略未配置目标地址时退回 forward。
+func GetFirstFlightPolicy(listener, class string) FirstFlightPolicy {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p := FirstFlightPolicy{Action: firstFlightPolicies[class], DivertTarget: divertTarget}
+	if v, ok := listenerPolicies[listener][class]; ok {
+		p.Action = v
+	}
+	if v, ok := listenerDivertTarget[listener]; ok {
+		p.DivertTarget = v
+	}
+	switch p.Action {
+	case PolicyBlock, PolicyCount:
+	case PolicyDivert:
+		if p.DivertTarget == "" {
+			p.Action = PolicyForward
+		}
+	default:
+		p.Action = PolicyForward
+	}
+	return p
+}
+
+// ReportFirstFlight 记录首包分类的处理结果，计数写入 stats:firstflight:<监听器>:<分类>:<策略>
+func ReportFirstFlight(listener, class, action string) {
+	IncrStat("firstflight:" + listener + ":" + class + ":" + action)
+}
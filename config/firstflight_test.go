@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestGetFirstFlightPolicy(t *testing.T) {
+	mu.Lock()
+	oldPolicies, oldTarget, oldListener, oldListenerTarget := firstFlightPolicies, divertTarget, listenerPolicies, listenerDivertTarget
+	firstFlightPolicies = map[string]string{
+		FlightNonTLS:    PolicyDivert,
+		FlightMalformed: PolicyBlock,
+		FlightSSLv2:     "unknown",
+		FlightECH:       PolicyForward,
+	}
+	divertTarget = ""
+	listenerPolicies = map[string]map[string]string{
+		"8443": {FlightMalformed: PolicyCount, FlightECH: PolicyDivert},
+		"9443": {FlightECH: PolicyDivert},
+	}
+	listenerDivertTarget = map[string]string{"8443": "10.0.0.2:443"}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		firstFlightPolicies, divertTarget, listenerPolicies, listenerDivertTarget = oldPolicies, oldTarget, oldListener, oldListenerTarget
+		mu.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		listener string
+		class    string
+		want     FirstFlightPolicy
+	}{
+		{"全局策略", "443", FlightMalformed, FirstFlightPolicy{PolicyBlock, ""}},
+		{"未知策略按 forward", "443", FlightSSLv2, FirstFlightPolicy{PolicyForward, ""}},
+		{"全局 divert 未配置目标时退回 forward", "443", FlightNonTLS, FirstFlightPolicy{PolicyForward, ""}},
+		{"监听器覆盖策略", "8443", FlightMalformed, FirstFlightPolicy{PolicyCount, "10.0.0.2:443"}},
+		{"全局 divert 使用监听器的目标", "8443", FlightNonTLS, FirstFlightPolicy{PolicyDivert, "10.0.0.2:443"}},
+		{"监听器 divert", "8443", FlightECH, FirstFlightPolicy{PolicyDivert, "10.0.0.2:443"}},
+		{"监听器未覆盖的分类使用全局策略", "8443", FlightSSLv2, FirstFlightPolicy{PolicyForward, "10.0.0.2:443"}},
+		{"监听器 divert 未配置目标时退回 forward", "9443", FlightECH, FirstFlightPolicy{PolicyForward, ""}},
+	}
+	for _, tt := range tests {
+		if got := GetFirstFlightPolicy(tt.listener, tt.class); got != tt.want {
+			t.Errorf("%s: GetFirstFlightPolicy(%q, %q) = %+v, want %+v", tt.name, tt.listener, tt.class, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 指纹首次出现：上报时以 ZADD NX 写入有序集合 <kind>:first_seen，分数为首次出现时间，多实例间只有一个实例写入成功；
+// 写入成功的实例把本周期第一个连接的客户端 IP、SNI 与 ClientHello 写入哈希 <kind>:first_sample（字段为指纹，值为 JSON），
+// ClientHello 最多保存 maxSampleClientHello 字节。两者不随 8 小时的 <kind>:last_seen 过期删除，否则空闲一段时间的
+// 指纹再次出现时会被当作新指纹告警；首次出现早于 first_seen_retention_seconds（默认 90 天）且当前不在 last_seen 中的指纹才删除，
+// 设为 0 时永久保留。
+//
+// 首次出现不超过 newfp_alert_window_seconds 的指纹，累计连接次数达到 newfp_alert_hits 时告警一次：
+// 输出日志并在配置了 newfp_webhook_url 时以 JSON POST 通知。是否达到阈值由 ZINCRBY 的返回值判断，多实例间同样只告警一次
+const (
+	webhookTimeout       = 5 * time.Second
+	maxSampleClientHello = 4096
+)
+
+var (
+	newFPAlertHits     int64 = 100
+	newFPAlertWindow   int64 = 3600
+	newFPWebhookURL          = ""
+	firstSeenRetention int64 = 90 * 24 * 3600
+
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+)
+
+// FirstSample 为指纹首次出现时的连接样本
+type FirstSample struct {
+	Time        int64  `json:"time"`
+	IP          string `json:"ip"`
+	SNI         string `json:"sni"`
+	ClientHello string `json:"clienthello"` // 十六进制，超过 maxSampleClientHello 字节时截断
+	Length      int    `json:"length"`      // ClientHello 的原始长度
+}
+
+// NewFingerprint 为一个新出现的指纹，也是告警通知的内容
+type NewFingerprint struct {
+	Kind        string       `json:"kind"`
+	Fingerprint string       `json:"fingerprint"`
+	FirstSeen   int64        `json:"first_seen"`
+	Hits        int64        `json:"hits"`
+	Sample      *FirstSample `json:"sample,omitempty"`
+}
+
+// firstSeenResult 为上报 pipeline 中与首次出现相关的命令
+type firstSeenResult struct {
+	hits      *redis.FloatCmd // ZINCRBY 后的累计连接次数
+	added     *redis.IntCmd   // ZADD NX 是否写入
+	firstSeen *redis.FloatCmd
+}
+
+func refreshNewFPFlags() {
+	_newFPAlertHits, _ := getInt("config:newfp_alert_hits", newFPAlertHits)
+	_newFPAlertWindow, _ := getInt("config:newfp_alert_window_seconds", newFPAlertWindow)
+	_newFPWebhookURL, _ := getOptionalString("config:newfp_webhook_url")
+	_firstSeenRetention, _ := getInt("config:first_seen_retention_seconds", firstSeenRetention)
+
+	mu.Lock()
+	newFPAlertHits = _newFPAlertHits
+	newFPAlertWindow = _newFPAlertWindow
+	newFPWebhookURL = _newFPWebhookURL
+	firstSeenRetention = _firstSeenRetention
+	mu.Unlock()
+}
+
+func firstSampleKey(kind string) string { return kind + ":first_sample" }
+
+// handleFirstSeen 为本实例首次写入的指纹记录样本，并对达到阈值的新指纹告警
+func handleFirstSeen(kind string, counts map[string]int, results map[string]firstSeenResult, samples map[string]ClientSample, t time.Time) {
+	mu.RLock()
+	threshold, window, url := newFPAlertHits, newFPAlertWindow, newFPWebhookURL
+	mu.RUnlock()
+
+	pipe := rdb.Pipeline()
+	for fp, r := range results {
+		if r.added.Val() == 1 {
+			if s, ok := samples[fp]; ok {
+				data, _ := json.Marshal(newFirstSample(s, t))
+				pipe.HSetNX(ctx, firstSampleKey(kind), fp, data)
+			}
+		}
+
+		hits := int64(r.hits.Val())
+		firstSeen := int64(r.firstSeen.Val())
+		if !crossesNewFPThreshold(hits, int64(counts[fp]), threshold, t.Unix()-firstSeen, window) {
+			continue
+		}
+		event := NewFingerprint{Kind: kind, Fingerprint: fp, FirstSeen: firstSeen, Hits: hits}
+		if s, ok := samples[fp]; ok && r.added.Val() == 1 {
+			event.Sample = newFirstSample(s, t)
+		}
+		go alertNewFingerprint(event, url)
+	}
+	if pipe.Len() == 0 {
+		return
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 写入指纹首次出现样本失败", "kind", kind, "err", err)
+	}
+}
+
+// crossesNewFPThreshold 判断本周期的 count 次连接是否使累计次数 hits 首次达到阈值，age 为指纹首次出现至今的秒数
+func crossesNewFPThreshold(hits, count, threshold, age, window int64) bool {
+	return threshold > 0 && age <= window && hits >= threshold && hits-count < threshold
+}
+
+func newFirstSample(s ClientSample, t time.Time) *FirstSample {
+	hello := s.ClientHello[:min(len(s.ClientHello), maxSampleClientHello)]
+	return &FirstSample{Time: t.Unix(), IP: s.IP, SNI: s.SNI, ClientHello: hex.EncodeToString(hello), Length: len(s.ClientHello)}
+}
+
+// cleanupFirstSeen 删除首次出现超过保留时长且最近未出现的指纹的首次出现时间与样本，
+// 需在 <kind>:last_seen 清理之后调用。被删除的指纹再次出现时重新按新指纹处理
+func cleanupFirstSeen(kind string) {
+	mu.RLock()
+	retention := firstSeenRetention
+	mu.RUnlock()
+	if retention <= 0 {
+		return
+	}
+
+	expireScore := fmt.Sprintf("%d", time.Now().Unix()-retention)
+	old, err := rdb.ZRangeByScore(ctx, kind+":first_seen", &redis.ZRangeBy{Min: "-inf", Max: expireScore}).Result()
+	if err != nil {
+		slog.Warn("[WARN] 读取过期首次出现记录失败", "kind", kind, "err", err)
+		return
+	}
+	if len(old) == 0 {
+		return
+	}
+	// 仍在 last_seen 中的指纹近期还在出现，保留
+	scores, err := rdb.ZMScore(ctx, kind+":last_seen", old...).Result()
+	if err != nil {
+		slog.Warn("[WARN] 读取指纹最后出现时间失败", "kind", kind, "err", err)
+		return
+	}
+	var fps []string
+	for i, fp := range old {
+		if scores[i] == 0 {
+			fps = append(fps, fp)
+		}
+	}
+	if len(fps) == 0 {
+		return
+	}
+	members := make([]interface{}, len(fps))
+	for i, fp := range fps {
+		members[i] = fp
+	}
+	pipe := rdb.Pipeline()
+	pipe.ZRem(ctx, kind+":first_seen", members...)
+	pipe.HDel(ctx, firstSampleKey(kind), fps...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 清理指纹首次出现记录失败", "kind", kind, "err", err)
+	}
+}
+
+func alertNewFingerprint(event NewFingerprint, url string) {
+	slog.Warn("[NEWFP] 新指纹达到告警阈值", "kind", event.Kind, "fp", event.Fingerprint, "hits", event.Hits,
+		"firstSeen", time.Unix(event.FirstSeen, 0).Format(time.DateTime))
+	IncrStat("newfp:alert")
+	if url == "" {
+		return
+	}
+	if event.Sample == nil {
+		// 首次出现在之前的上报周期，样本从 Redis 读取
+		if data, err := rdb.HGet(ctx, firstSampleKey(event.Kind), event.Fingerprint).Bytes(); err == nil {
+			var s FirstSample
+			if json.Unmarshal(data, &s) == nil {
+				event.Sample = &s
+			}
+		}
+	}
+	if err := postWebhook(url, event); err != nil {
+		IncrStat("newfp:webhook_failed")
+		slog.Warn("[WARN] 新指纹通知失败", "url", url, "fp", event.Fingerprint, "err", err)
+	}
+}
+
+func postWebhook(url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ListNewFingerprints 返回 since 之后首次出现的指纹（按首次出现时间排序，最多 limit 个）及其累计连接次数与样本
+func ListNewFingerprints(kind string, since time.Time, limit int64) ([]NewFingerprint, error) {
+	zs, err := rdb.ZRangeByScoreWithScores(ctx, kind+":first_seen", &redis.ZRangeBy{
+		Min:   fmt.Sprint(since.Unix()),
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(zs) == 0 {
+		return nil, nil
+	}
+
+	pipe := rdb.Pipeline()
+	hits := make([]*redis.FloatCmd, len(zs))
+	samples := make([]*redis.StringCmd, len(zs))
+	for i, z := range zs {
+		fp := z.Member.(string)
+		hits[i] = pipe.ZScore(ctx, kind+":count", fp)
+		samples[i] = pipe.HGet(ctx, firstSampleKey(kind), fp)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	list := make([]NewFingerprint, len(zs))
+	for i, z := range zs {
+		list[i] = NewFingerprint{
+			Kind:        kind,
+			Fingerprint: z.Member.(string),
+			FirstSeen:   int64(z.Score),
+			Hits:        int64(hits[i].Val()),
+		}
+		var s FirstSample
+		if err := json.Unmarshal([]byte(samples[i].Val()), &s); err == nil {
+			list[i].Sample = &s
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrossesNewFPThreshold(t *testing.T) {
+	tests := []struct {
+		name                             string
+		hits, count, threshold, age, win int64
+		want                             bool
+	}{
+		{"未达到阈值", 99, 10, 100, 60, 3600, false},
+		{"本周期达到阈值", 105, 10, 100, 60, 3600, true},
+		{"恰好达到阈值", 100, 100, 100, 0, 3600, true},
+		{"之前已达到阈值", 120, 10, 100, 60, 3600, false},
+		{"超出时间窗口", 105, 10, 100, 7200, 3600, false},
+		{"关闭告警", 105, 10, 0, 60, 3600, false},
+	}
+	for _, tt := range tests {
+		if got := crossesNewFPThreshold(tt.hits, tt.count, tt.threshold, tt.age, tt.win); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListNewFingerprints(t *testing.T) {
+	useTestRedis(t)
+	old := time.Now().Add(-48 * time.Hour)
+	flushFingerprintReports(KindJA4, map[string]int{"fp-old": 1}, fingerprintReportData{}, old)
+
+	var r fingerprintReport
+	r.add("fp-new", ClientSample{IP: "192.0.2.1", SNI: "a.example", ClientHello: []byte{0x16, 0x03, 0x01}})
+	now := time.Now()
+	flushFingerprintReports(KindJA4, map[string]int{"fp-new": 2, "fp-nosample": 1}, r.take(), now)
+
+	list, err := ListNewFingerprints(KindJA4, now.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d fingerprints, want 2: %+v", len(list), list)
+	}
+	byFP := map[string]NewFingerprint{}
+	for _, fp := range list {
+		byFP[fp.Fingerprint] = fp
+	}
+	got := byFP["fp-new"]
+	if got.Hits != 2 || got.FirstSeen != now.Unix() || got.Sample == nil || got.Sample.ClientHello != "160301" || got.Sample.SNI != "a.example" {
+		t.Errorf("fp-new = %+v", got)
+	}
+	// 没有样本时 HGET 返回 redis.Nil，Sample 为空
+	if s := byFP["fp-nosample"]; s.Sample != nil || s.Hits != 1 {
+		t.Errorf("fp-nosample = %+v", s)
+	}
+
+	if list, err := ListNewFingerprints(KindJA3, now.Add(-time.Hour), 10); err != nil || len(list) != 0 {
+		t.Fatalf("ListNewFingerprints(empty) = %+v, %v", list, err)
+	}
+}
+
+func TestFirstSeenCleanup(t *testing.T) {
+	s := useTestRedis(t)
+	var r fingerprintReport
+	r.add("fp-old", ClientSample{IP: "192.0.2.1", ClientHello: make([]byte, maxSampleClientHello+100)})
+	r.add("fp-live", ClientSample{IP: "192.0.2.2", ClientHello: []byte{0x16}})
+	flushFingerprintReports(KindJA4, map[string]int{"fp-old": 1, "fp-live": 1}, r.take(), time.Now().Add(-24*time.Hour))
+	flushFingerprintReports(KindJA4, map[string]int{"fp-live": 1}, fingerprintReportData{}, time.Now())
+
+	list, err := ListNewFingerprints(KindJA4, time.Now().Add(-48*time.Hour), 10)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListNewFingerprints = %+v, %v", list, err)
+	}
+	for _, fp := range list {
+		if fp.Fingerprint == "fp-old" && (fp.Sample.Length != maxSampleClientHello+100 || len(fp.Sample.ClientHello) != 2*maxSampleClientHello) {
+			t.Errorf("样本应截断到 %d 字节: length=%d hex=%d", maxSampleClientHello, fp.Sample.Length, len(fp.Sample.ClientHello))
+		}
+	}
+
+	// 8 小时的 last_seen 过期不删除首次出现记录，空闲后再出现的指纹不会被当作新指纹
+	CleanupOldFingerprintEntries(3600)
+	if members, _ := s.ZMembers("ja4:first_seen"); len(members) != 2 {
+		t.Errorf("ja4:first_seen = %v, want both fingerprints kept", members)
+	}
+
+	// 超过保留时长：最近仍出现的 fp-live 保留，空闲的 fp-old 删除
+	mu.Lock()
+	oldRetention := firstSeenRetention
+	firstSeenRetention = 3600
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		firstSeenRetention = oldRetention
+		mu.Unlock()
+	})
+	CleanupOldFingerprintEntries(3600)
+
+	if members, _ := s.ZMembers("ja4:first_seen"); len(members) != 1 || members[0] != "fp-live" {
+		t.Errorf("ja4:first_seen = %v, want [fp-live]", members)
+	}
+	if fields, _ := s.HKeys("ja4:first_sample"); len(fields) != 1 || fields[0] != "fp-live" {
+		t.Errorf("ja4:first_sample = %v, want [fp-live]", fields)
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import "time"
+
+var (
+	// ClientHello 重组限制：超过长度上限，或首字节到达后超过时限仍未收齐时断开连接
+	clientHelloMaxBytes int64 = 32 * 1024
+	clientHelloTimeout        = 5 * time.Second
+
+	// 慢速连接防护：连接建立后必须在 handshakeTimeout 内完成首包判定，
+	// 判定前缓存的数据不得超过 preHandshakeMaxBytes，已建立的转发空闲超过 idleTimeout 后断开
+	handshakeTimeout           = 10 * time.Second
+	preHandshakeMaxBytes int64 = 64 * 1024
+	idleTimeout                = 5 * time.Minute
+)
+
+func refreshHandshakeFlags() {
+	_clientHelloMaxBytes, _ := getInt("config:clienthello_max_bytes", clientHelloMaxBytes)
+	_clientHelloTimeout, _ := getInt("config:clienthello_timeout_ms", int64(clientHelloTimeout/time.Millisecond))
+	_handshakeTimeout, _ := getInt("config:handshake_timeout_ms", int64(handshakeTimeout/time.Millisecond))
+	_preHandshakeMaxBytes, _ := getInt("config:prehandshake_max_bytes", preHandshakeMaxBytes)
+	_idleTimeout, _ := getInt("config:idle_timeout_seconds", int64(idleTimeout/time.Second))
+
+	mu.Lock()
+	clientHelloMaxBytes = _clientHelloMaxBytes
+	clientHelloTimeout = time.Duration(_clientHelloTimeout) * time.Millisecond
+	handshakeTimeout = time.Duration(_handshakeTimeout) * time.Millisecond
+	preHandshakeMaxBytes = _preHandshakeMaxBytes
+	idleTimeout = time.Duration(_idleTimeout) * time.Second
+	mu.Unlock()
+}
+
+// ClientHelloMaxBytes 返回 ClientHello 重组的长度上限
+func ClientHelloMaxBytes() int { mu.RLock(); defer mu.RUnlock(); return int(clientHelloMaxBytes) }
+
+// ClientHelloTimeout 返回 ClientHello 重组的时限
+func ClientHelloTimeout() time.Duration { mu.RLock(); defer mu.RUnlock(); return clientHelloTimeout }
+
+// HandshakeTimeout 返回连接建立到完成首包判定的时限，0 表示不限制
+func HandshakeTimeout() time.Duration { mu.RLock(); defer mu.RUnlock(); return handshakeTimeout }
+
+// PreHandshakeMaxBytes 返回首包判定前允许缓存的最大字节数
+func PreHandshakeMaxBytes() int { mu.RLock(); defer mu.RUnlock(); return int(preHandshakeMaxBytes) }
+
+// IdleTimeout 返回已建立转发的空闲超时，0 表示不限制
+func IdleTimeout() time.Duration { mu.RLock(); defer mu.RUnlock(); return idleTimeout }
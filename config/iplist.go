@@ -0,0 +1,87 @@
+package config
+
+import (
+	"log/slog"
+	"net/netip"
+
+	"tls-proxy/util"
+)
+
+// IP 黑白名单：集合 ip:blacklist / ip:whitelist，成员为 CIDR 网段或单个 IP，支持 IPv4 与 IPv6。
+// 黑名单中的客户端在连接建立时直接断开；白名单（例如监控探针）跳过所有指纹检查。
+var (
+	enableIPBlacklist = false
+	enableIPWhitelist = false
+	ipBlacklist       = util.NewIPTrie()
+	ipWhitelist       = util.NewIPTrie()
+)
+
+func refreshIPFlags() {
+	_enableIPBlacklist, _ := getBool("config:ip_blacklist_enabled", enableIPBlacklist)
+	_enableIPWhitelist, _ := getBool("config:ip_whitelist_enabled", enableIPWhitelist)
+
+	mu.Lock()
+	enableIPBlacklist = _enableIPBlacklist
+	enableIPWhitelist = _enableIPWhitelist
+	mu.Unlock()
+}
+
+// loadIPTrie 读取 CIDR 集合并构建前缀树，无法解析的成员会被跳过
+func loadIPTrie(key string) (*util.IPTrie, error) {
+	list, err := rdb.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	trie := util.NewIPTrie()
+	for _, v := range list {
+		p, err := util.ParsePrefix(v)
+		if err != nil {
+			slog.Warn("[WARN] 忽略无效的 IP 网段", "key", key, "value", v, "err", err)
+			continue
+		}
+		trie.Insert(p)
+	}
+	return trie, nil
+}
+
+func refreshIPLists() error {
+	_ipBlacklist, err := loadIPTrie("ip:blacklist")
+	if err != nil {
+		return err
+	}
+	_ipWhitelist, err := loadIPTrie("ip:whitelist")
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	ipBlacklist = _ipBlacklist
+	ipWhitelist = _ipWhitelist
+	mu.Unlock()
+	return nil
+}
+
+// ShouldBlockIP 判断客户端 IP 是否被临时封禁或命中 IP 黑名单
+func ShouldBlockIP(ip string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if tempBlockedLocked(KindIP, ip) {
+		return true
+	}
+	if !enableIPBlacklist {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && ipBlacklist.Contains(addr)
+}
+
+// IsIPWhitelisted 判断客户端 IP 是否命中 IP 白名单，命中时跳过指纹检查
+func IsIPWhitelisted(ip string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !enableIPWhitelist {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && ipWhitelist.Contains(addr)
+}
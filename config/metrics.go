@@ -0,0 +1,31 @@
+package config
+
+import (
+	"tls-proxy/metrics"
+)
+
+var (
+	// 指纹作为 metrics 标签需要显式开启，只保留本机近期连接次数最多的 limit 个指纹，其余合并为 other
+	enableFingerprintMetrics       = false
+	fingerprintMetricsLimit  int64 = 50
+
+	redisRefreshTotal   = metrics.NewCounter("tlsproxy_redis_refresh_total", "从 Redis 刷新配置的次数", "result")
+	redisRefreshSeconds = metrics.NewHistogram("tlsproxy_redis_refresh_seconds", "从 Redis 刷新配置的耗时", metrics.DefBuckets)
+)
+
+func refreshMetricsFlags() {
+	_enableFingerprintMetrics, _ := getBool("config:metrics_fingerprint_labels", enableFingerprintMetrics)
+	_fingerprintMetricsLimit, _ := getInt("config:metrics_fingerprint_limit", fingerprintMetricsLimit)
+
+	mu.Lock()
+	enableFingerprintMetrics = _enableFingerprintMetrics
+	fingerprintMetricsLimit = _fingerprintMetricsLimit
+	mu.Unlock()
+}
+
+// FingerprintMetrics 返回是否以指纹作为 metrics 标签，以及每种指纹允许的不同取值个数
+func FingerprintMetrics() (bool, int) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return enableFingerprintMetrics, int(fingerprintMetricsLimit)
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 连接速率限制：令牌桶，按 config:ratelimit_key 指定的维度计数，可选值：
+// ip、ja4、ja3n 或用 "+" 组合，例如 ip+ja4。
+// config:ratelimit_mode 为 local 时在本机内存中计数，为 redis 时在集群内共享令牌桶。
+//
+// redis 模式下同样由本机令牌桶立即判定，不在 event-loop 中等待 Redis：
+// 本机放行的次数每 rateLimitSyncInterval 批量扣减到 Redis 中的共享令牌桶，
+// 再以共享桶的剩余令牌校正本机令牌桶，因此集群内最多多放行一个同步周期内各实例的本机放行量。
+// Redis 不可用或同步失败时只按本机计数。
+const (
+	RateLimitModeLocal = "local"
+	RateLimitModeRedis = "redis"
+
+	rateLimitSyncInterval = 200 * time.Millisecond
+	rateLimitSyncTimeout  = time.Second
+)
+
+var (
+	enableRateLimit         = false
+	rateLimitKey            = "ip"
+	rateLimitMode           = RateLimitModeLocal
+	rateLimitRate   float64 = 10
+	rateLimitBurst  int64   = 20
+
+	localBuckets     = make(map[string]*tokenBucket)
+	localBucketsMu   sync.Mutex
+	bucketGCOnce     sync.Once
+	bucketSyncOnce   sync.Once
+	bucketIdleExpiry = 10 * time.Minute
+
+	// KEYS[1]: 桶; ARGV[1]: 每秒令牌数; ARGV[2]: 桶容量; ARGV[3]: 扣减的令牌数。
+	// 各实例已经放行的连接无条件扣减，令牌最多欠下一个桶容量，返回扣减后的剩余令牌数
+	tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+tokens = math.max(-burst, tokens - n)
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * burst / rate * 1000) + 1000)
+return tostring(tokens)
+`)
+)
+
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	pending int64 // redis 模式下尚未同步到共享令牌桶的放行次数
+}
+
+// take 按当前速率补充令牌并尝试取出一个
+func (b *tokenBucket) take(now time.Time, rate float64, burst int64) bool {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func refreshRateLimitFlags() {
+	_enableRateLimit, _ := getBool("config:ratelimit_enabled", enableRateLimit)
+	_rateLimitKey, _ := getString("config:ratelimit_key", rateLimitKey)
+	_rateLimitMode, _ := getString("config:ratelimit_mode", rateLimitMode)
+	_rateLimitRate, _ := getFloat("config:ratelimit_rate", rateLimitRate)
+	_rateLimitBurst, _ := getInt("config:ratelimit_burst", rateLimitBurst)
+
+	if _rateLimitRate <= 0 || _rateLimitBurst <= 0 {
+		slog.Warn("[WARN] 限速配置无效，保持当前配置", "rate", _rateLimitRate, "burst", _rateLimitBurst)
+		return
+	}
+
+	mu.Lock()
+	enableRateLimit = _enableRateLimit
+	rateLimitKey = _rateLimitKey
+	rateLimitMode = _rateLimitMode
+	rateLimitRate = _rateLimitRate
+	rateLimitBurst = _rateLimitBurst
+	mu.Unlock()
+}
+
+// RateLimitUses 判断限速键是否用到了某个维度，用于决定是否需要计算对应指纹
+func RateLimitUses(kind string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !enableRateLimit {
+		return false
+	}
+	for _, part := range strings.Split(rateLimitKey, "+") {
+		if part == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowRate 检查连接是否超出速率限制，返回是否放行及所使用的限速键。
+// 限速键依赖的指纹为空（例如非 TLS 流量或无法解析的 ClientHello）时改按客户端 IP 限速，
+// 避免省略指纹绕过限制。判定只访问本机内存，可以在 event-loop 中调用。
+func AllowRate(ip, ja3n, ja4 string) (bool, string) {
+	mu.RLock()
+	enabled, keySpec, mode := enableRateLimit, rateLimitKey, rateLimitMode
+	rate, burst := rateLimitRate, rateLimitBurst
+	mu.RUnlock()
+
+	if !enabled {
+		return true, ""
+	}
+
+	parts := strings.Split(keySpec, "+")
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		var v string
+		switch part {
+		case KindIP:
+			v = ip
+		case KindJA3N:
+			v = ja3n
+		case KindJA4:
+			v = ja4
+		default:
+			slog.Warn("[WARN] 未知的限速维度", "key", keySpec)
+			return true, ""
+		}
+		if v == "" {
+			values = nil
+			break
+		}
+		values = append(values, v)
+	}
+	key := KindIP + ":" + ip
+	if values != nil {
+		key = keySpec + ":" + strings.Join(values, "|")
+	}
+
+	shared := mode == RateLimitModeRedis && redisAvailable
+	if shared {
+		bucketSyncOnce.Do(scheduleBucketSync)
+	}
+	return allowRateLocal(key, rate, burst, shared), key
+}
+
+func allowRateLocal(key string, rate float64, burst int64, shared bool) bool {
+	bucketGCOnce.Do(scheduleBucketGC)
+
+	now := time.Now()
+	localBucketsMu.Lock()
+	defer localBucketsMu.Unlock()
+	b, ok := localBuckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		localBuckets[key] = b
+	}
+	if !b.take(now, rate, burst) {
+		return false
+	}
+	if shared {
+		b.pending++
+	}
+	return true
+}
+
+// scheduleBucketSync 定期把本机放行次数扣减到 Redis 中的共享令牌桶
+func scheduleBucketSync() {
+	ticker := time.NewTicker(rateLimitSyncInterval)
+	go func() {
+		for range ticker.C {
+			syncBuckets()
+		}
+	}()
+}
+
+// syncBuckets 在一个 pipeline 中扣减各令牌桶的放行次数，并以共享桶的剩余令牌校正本机令牌桶
+func syncBuckets() {
+	mu.RLock()
+	rate, burst := rateLimitRate, rateLimitBurst
+	mu.RUnlock()
+
+	localBucketsMu.Lock()
+	taken := make(map[string]int64)
+	for key, b := range localBuckets {
+		if b.pending > 0 {
+			taken[key] = b.pending
+			b.pending = 0
+		}
+	}
+	localBucketsMu.Unlock()
+	if len(taken) == 0 || !redisAvailable {
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx, rateLimitSyncTimeout)
+	defer cancel()
+	remaining, err := runBucketScript(c, taken, rate, burst, false)
+	if redis.HasErrorPrefix(err, "NOSCRIPT") {
+		remaining, err = runBucketScript(c, taken, rate, burst, true)
+	}
+	if err != nil {
+		slog.Debug("同步 Redis 限速令牌桶失败，使用本机计数", "keys", len(taken), "err", err)
+		return
+	}
+
+	now := time.Now()
+	localBucketsMu.Lock()
+	defer localBucketsMu.Unlock()
+	for key, tokens := range remaining {
+		if b, ok := localBuckets[key]; ok {
+			// 同步期间本机又放行的次数尚未扣减到共享桶
+			b.tokens = math.Min(b.tokens, tokens-float64(b.pending))
+			b.last = now
+		}
+	}
+}
+
+// runBucketScript 执行令牌桶脚本，返回各限速键在共享桶中的剩余令牌数。
+// 首次执行使用 EVALSHA，脚本未加载时以 eval 为 true 重新执行
+func runBucketScript(c context.Context, taken map[string]int64, rate float64, burst int64, eval bool) (map[string]float64, error) {
+	pipe := rdb.Pipeline()
+	cmds := make(map[string]*redis.Cmd, len(taken))
+	for key, n := range taken {
+		keys := []string{"ratelimit:bucket:" + key}
+		if eval {
+			cmds[key] = tokenBucketScript.Eval(c, pipe, keys, rate, burst, n)
+		} else {
+			cmds[key] = tokenBucketScript.EvalSha(c, pipe, keys, rate, burst, n)
+		}
+	}
+	if _, err := pipe.Exec(c); err != nil {
+		return nil, err
+	}
+	remaining := make(map[string]float64, len(cmds))
+	for key, cmd := range cmds {
+		if tokens, err := cmd.Float64(); err == nil {
+			remaining[key] = tokens
+		}
+	}
+	return remaining, nil
+}
+
+// scheduleBucketGC 定期清理长时间未使用的本机令牌桶
+func scheduleBucketGC() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			expireBefore := time.Now().Add(-bucketIdleExpiry)
+			localBucketsMu.Lock()
+			for key, b := range localBuckets {
+				if b.last.Before(expireBefore) {
+					delete(localBuckets, key)
+				}
+			}
+			localBucketsMu.Unlock()
+		}
+	}()
+}
+
+// ReportRateLimitedEvent 超出速率限制时调用，按分钟累加到 ratelimit 的阻止计数序列中
+func ReportRateLimitedEvent(key string) {
+	recordSeries(RuleRateLimit, SeriesBlocked, key, 1)
+}
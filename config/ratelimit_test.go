@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 3, last: now}
+
+	for i := 0; i < 3; i++ {
+		if !b.take(now, 1, 3) {
+			t.Fatalf("take %d: expected allowed within burst", i)
+		}
+	}
+	if b.take(now, 1, 3) {
+		t.Fatal("expected denied after burst is exhausted")
+	}
+
+	// 1 token/s: half a second is not enough, a full second is
+	if b.take(now.Add(500*time.Millisecond), 1, 3) {
+		t.Fatal("expected denied before a full token is refilled")
+	}
+	if !b.take(now.Add(time.Second), 1, 3) {
+		t.Fatal("expected allowed after refill")
+	}
+
+	// refill never exceeds burst
+	b.take(now.Add(time.Hour), 1, 3)
+	if b.tokens > 3 {
+		t.Fatalf("tokens exceeded burst: %v", b.tokens)
+	}
+}
+
+func TestAllowRateFallsBackToIP(t *testing.T) {
+	mu.Lock()
+	oldEnabled, oldKey, oldMode := enableRateLimit, rateLimitKey, rateLimitMode
+	enableRateLimit, rateLimitKey, rateLimitMode = true, "ip+ja4", RateLimitModeLocal
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		enableRateLimit, rateLimitKey, rateLimitMode = oldEnabled, oldKey, oldMode
+		mu.Unlock()
+	})
+
+	if _, key := AllowRate("192.0.2.1", "", "t13d1516h2_aaa_bbb"); key != "ip+ja4:192.0.2.1|t13d1516h2_aaa_bbb" {
+		t.Fatalf("key = %q", key)
+	}
+	// 没有 JA4 时按 IP 限速，而不是放行
+	if _, key := AllowRate("192.0.2.1", "", ""); key != "ip:192.0.2.1" {
+		t.Fatalf("key without ja4 = %q", key)
+	}
+}
+
+func TestSyncBuckets(t *testing.T) {
+	useTestRedis(t)
+	key := "ja4:test-sync"
+	localBucketsMu.Lock()
+	// 另一个实例已经用完了共享桶
+	localBuckets[key] = &tokenBucket{tokens: 5, last: time.Now(), pending: 20}
+	localBucketsMu.Unlock()
+	t.Cleanup(func() {
+		localBucketsMu.Lock()
+		delete(localBuckets, key)
+		localBucketsMu.Unlock()
+	})
+
+	syncBuckets()
+
+	localBucketsMu.Lock()
+	b := localBuckets[key]
+	tokens, pending := b.tokens, b.pending
+	localBucketsMu.Unlock()
+	if pending != 0 {
+		t.Fatalf("pending = %d after sync", pending)
+	}
+	// 默认容量 20：扣减 20 次后共享桶剩余约 0 个令牌
+	if tokens >= 1 {
+		t.Fatalf("local tokens = %v, expected corrected to shared bucket", tokens)
+	}
+	if v, err := rdb.HGet(ctx, "ratelimit:bucket:"+key, "tokens").Float64(); err != nil || v >= 1 {
+		t.Fatalf("shared tokens = %v, err = %v", v, err)
+	}
+}
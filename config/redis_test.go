@@ -0,0 +1,22 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// useTestRedis 把 rdb 指向一个内存中的 Redis，测试结束后恢复
+func useTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	s := miniredis.RunT(t)
+	oldRdb, oldAvailable := rdb, redisAvailable
+	rdb = redis.NewClient(&redis.Options{Addr: s.Addr()})
+	redisAvailable = true
+	t.Cleanup(func() {
+		rdb.Close()
+		rdb, redisAvailable = oldRdb, oldAvailable
+	})
+	return s
+}
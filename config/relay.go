@@ -0,0 +1,41 @@
+package config
+
+import "time"
+
+var (
+	// 转发背压：发往对端但尚未写入内核的数据超过 relayBufferBytes 时暂停读取源端，
+	// 回落到一半以下时恢复；暂停期间源端已读入内存的数据超过 relayMaxBufferedBytes 时断开
+	relayBufferBytes      int64 = 256 * 1024
+	relayMaxBufferedBytes int64 = 4 * 1024 * 1024
+
+	dialTimeout = 2 * time.Second
+
+	// 首包判定完成后把连接移出 event-loop，由内核通过 splice(2) 转发（仅 Linux）
+	enableSplice = false
+)
+
+func refreshRelayFlags() {
+	_relayBufferBytes, _ := getInt("config:relay_buffer_bytes", relayBufferBytes)
+	_relayMaxBufferedBytes, _ := getInt("config:relay_max_buffered_bytes", relayMaxBufferedBytes)
+	_dialTimeout, _ := getInt("config:dial_timeout_ms", int64(dialTimeout/time.Millisecond))
+	_enableSplice, _ := getBool("config:splice_enabled", enableSplice)
+
+	mu.Lock()
+	relayBufferBytes = _relayBufferBytes
+	relayMaxBufferedBytes = _relayMaxBufferedBytes
+	dialTimeout = time.Duration(_dialTimeout) * time.Millisecond
+	enableSplice = _enableSplice
+	mu.Unlock()
+}
+
+// RelayBufferBytes 返回转发背压的高水位
+func RelayBufferBytes() int64 { mu.RLock(); defer mu.RUnlock(); return relayBufferBytes }
+
+// RelayMaxBufferedBytes 返回暂停读取期间允许缓存的最大字节数
+func RelayMaxBufferedBytes() int64 { mu.RLock(); defer mu.RUnlock(); return relayMaxBufferedBytes }
+
+// DialTimeout 返回连接上游的超时时间
+func DialTimeout() time.Duration { mu.RLock(); defer mu.RUnlock(); return dialTimeout }
+
+// SpliceEnabled 返回是否启用 splice 转发
+func SpliceEnabled() bool { mu.RLock(); defer mu.RUnlock(); return enableSplice }
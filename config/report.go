@@ -0,0 +1,57 @@
+package config
+
+import "sync"
+
+// ClientSample 为上报指纹时附带的连接信息
+type ClientSample struct {
+	IP          string
+	SNI         string
+	ClientHello []byte // 完整的 ClientHello 记录，上报后不得修改
+}
+
+// fingerprintReport 在一个上报周期内收集每个指纹的客户端 IP、SNI 与首个连接的样本
+type fingerprintReport struct {
+	mu   sync.Mutex
+	data fingerprintReportData
+}
+
+type fingerprintReportData struct {
+	ips     map[[2]string]struct{} // [指纹, IP]
+	snis    map[[2]string]struct{} // [指纹, SNI]
+	samples map[string]ClientSample
+}
+
+var fingerprintReports = map[string]*fingerprintReport{
+	KindJA3:  {},
+	KindJA3N: {},
+	KindJA4:  {},
+}
+
+// add 记录一次连接，同一上报周期内重复的取值只记录一次，样本只保留第一个
+func (r *fingerprintReport) add(fp string, s ClientSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := &r.data
+	if d.ips == nil {
+		d.ips = make(map[[2]string]struct{})
+		d.snis = make(map[[2]string]struct{})
+		d.samples = make(map[string]ClientSample)
+	}
+	d.ips[[2]string{fp, s.IP}] = struct{}{}
+	if s.SNI != "" {
+		d.snis[[2]string{fp, s.SNI}] = struct{}{}
+	}
+	if _, ok := d.samples[fp]; !ok {
+		s.ClientHello = append([]byte(nil), s.ClientHello...)
+		d.samples[fp] = s
+	}
+}
+
+// take 取出本周期的数据并清空
+func (r *fingerprintReport) take() fingerprintReportData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.data
+	r.data = fingerprintReportData{}
+	return d
+}
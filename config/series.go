@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 阻止与采集计数按分钟、小时、天三种粒度分桶，每个指纹在每种粒度下按窗口分成多个哈希：
+//
+//	<kind>:<series>:<res>:<fp>:<窗口起始 Unix 时间>
+//
+// 字段为桶的起始 Unix 时间，值为计数。分钟桶按小时分窗口，小时桶按天分窗口，天桶按月分窗口（均为 UTC），
+// 窗口结束后再保留对应粒度的时长，由 Redis 过期删除。kind 为 ja3、ja3n、ja4 或 ratelimit（fp 为限速键）
+const (
+	SeriesBlocked   = "blocked"   // 被阻止的连接
+	SeriesCollected = "collected" // 采集到的连接
+)
+
+// 分桶粒度
+const (
+	ResMinute = "m"
+	ResHour   = "h"
+	ResDay    = "d"
+)
+
+// maxSeriesPoints 为单次查询返回的桶数上限
+const maxSeriesPoints = 10000
+
+var resolutions = []string{ResMinute, ResHour, ResDay}
+
+var (
+	// 各粒度在窗口结束后的保留时长（秒）
+	seriesMinuteRetention int64 = 86400
+	seriesHourRetention   int64 = 7 * 86400
+	seriesDayRetention    int64 = 90 * 86400
+
+	// 尚未写入 Redis 的计数，按分钟桶累加
+	seriesCounter   = make(map[seriesKey]int64)
+	seriesCounterMu sync.Mutex
+)
+
+type seriesKey struct {
+	kind   string
+	series string
+	fp     string
+	minute int64 // 分钟桶的起始 Unix 时间
+}
+
+// SeriesPoint 为序列中的一个桶
+type SeriesPoint struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+func refreshSeriesFlags() {
+	_seriesMinuteRetention, _ := getInt("config:series_minute_retention_seconds", seriesMinuteRetention)
+	_seriesHourRetention, _ := getInt("config:series_hour_retention_seconds", seriesHourRetention)
+	_seriesDayRetention, _ := getInt("config:series_day_retention_seconds", seriesDayRetention)
+
+	mu.Lock()
+	seriesMinuteRetention = _seriesMinuteRetention
+	seriesHourRetention = _seriesHourRetention
+	seriesDayRetention = _seriesDayRetention
+	mu.Unlock()
+}
+
+// seriesRetention 返回粒度对应的保留时长
+func seriesRetention(res string) time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	switch res {
+	case ResMinute:
+		return time.Duration(seriesMinuteRetention) * time.Second
+	case ResHour:
+		return time.Duration(seriesHourRetention) * time.Second
+	}
+	return time.Duration(seriesDayRetention) * time.Second
+}
+
+// seriesBucket 返回 t 所在桶的起始时间，以及桶所在窗口的起止时间
+func seriesBucket(res string, t time.Time) (start, winStart, winEnd time.Time) {
+	t = t.UTC()
+	switch res {
+	case ResMinute:
+		start = t.Truncate(time.Minute)
+		winStart = t.Truncate(time.Hour)
+		winEnd = winStart.Add(time.Hour)
+	case ResHour:
+		start = t.Truncate(time.Hour)
+		winStart = t.Truncate(24 * time.Hour)
+		winEnd = winStart.AddDate(0, 0, 1)
+	default:
+		start = t.Truncate(24 * time.Hour)
+		winStart = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		winEnd = winStart.AddDate(0, 1, 0)
+	}
+	return
+}
+
+func seriesStep(res string) time.Duration {
+	switch res {
+	case ResMinute:
+		return time.Minute
+	case ResHour:
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func seriesKeyName(kind, series, res, fp string, winStart time.Time) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%d", kind, series, res, fp, winStart.Unix())
+}
+
+// recordSeries 在内存中累加计数，由 flushSeries 定期写入 Redis
+func recordSeries(kind, series, fp string, n int64) {
+	k := seriesKey{kind: kind, series: series, fp: fp, minute: time.Now().Truncate(time.Minute).Unix()}
+	seriesCounterMu.Lock()
+	seriesCounter[k] += n
+	seriesCounterMu.Unlock()
+}
+
+// addSeries 把 t 时刻的计数写入三种粒度的桶，并设置所在窗口的过期时间
+func addSeries(pipe redis.Pipeliner, kind, series, fp string, t time.Time, n int64) {
+	for _, res := range resolutions {
+		start, winStart, winEnd := seriesBucket(res, t)
+		key := seriesKeyName(kind, series, res, fp, winStart)
+		pipe.HIncrBy(ctx, key, strconv.FormatInt(start.Unix(), 10), n)
+		pipe.ExpireAt(ctx, key, winEnd.Add(seriesRetention(res)))
+	}
+}
+
+// flushSeries 将内存中的计数写入 Redis，并清空已统计的数据
+func flushSeries() {
+	seriesCounterMu.Lock()
+	data := seriesCounter
+	seriesCounter = make(map[seriesKey]int64)
+	seriesCounterMu.Unlock()
+
+	if len(data) == 0 {
+		return
+	}
+	pipe := rdb.Pipeline()
+	for k, n := range data {
+		addSeries(pipe, k.kind, k.series, k.fp, time.Unix(k.minute, 0), n)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 上报分桶计数失败", "keys", len(data), "err", err)
+	}
+}
+
+// QuerySeries 返回一个指纹在 [from, to] 内按 res 粒度的计数，没有数据的桶计数为 0。
+// 尚未写入 Redis 的计数（最多一个上报周期）不包含在内
+func QuerySeries(kind, series, fp, res string, from, to time.Time) ([]SeriesPoint, error) {
+	switch res {
+	case ResMinute, ResHour, ResDay:
+	default:
+		return nil, fmt.Errorf("未知的粒度: %s", res)
+	}
+	first, _, _ := seriesBucket(res, from)
+	last, _, _ := seriesBucket(res, to)
+	if last.Before(first) {
+		return nil, fmt.Errorf("结束时间早于开始时间")
+	}
+	step := seriesStep(res)
+	if n := int(last.Sub(first)/step) + 1; n > maxSeriesPoints {
+		return nil, fmt.Errorf("查询范围过大: %d 个桶，上限 %d", n, maxSeriesPoints)
+	}
+
+	// 每个窗口读取一次
+	pipe := rdb.Pipeline()
+	windows := make(map[string]*redis.MapStringStringCmd)
+	for t := first; !t.After(last); t = t.Add(step) {
+		_, winStart, _ := seriesBucket(res, t)
+		key := seriesKeyName(kind, series, res, fp, winStart)
+		if _, ok := windows[key]; !ok {
+			windows[key] = pipe.HGetAll(ctx, key)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int64)
+	for _, cmd := range windows {
+		for field, v := range cmd.Val() {
+			ts, err1 := strconv.ParseInt(field, 10, 64)
+			n, err2 := strconv.ParseInt(v, 10, 64)
+			if err1 == nil && err2 == nil {
+				counts[ts] += n
+			}
+		}
+	}
+	points := make([]SeriesPoint, 0, int(last.Sub(first)/step)+1)
+	for t := first; !t.After(last); t = t.Add(step) {
+		points = append(points, SeriesPoint{Time: t, Count: counts[t.Unix()]})
+	}
+	return points, nil
+}
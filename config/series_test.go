@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesBucket(t *testing.T) {
+	ts := time.Date(2024, 2, 29, 23, 59, 30, 0, time.UTC)
+	tests := []struct {
+		res                     string
+		start, winStart, winEnd time.Time
+	}{
+		{ResMinute, time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC), time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{ResHour, time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{ResDay, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start, winStart, winEnd := seriesBucket(tt.res, ts.In(time.FixedZone("UTC+8", 8*3600)))
+		if !start.Equal(tt.start) || !winStart.Equal(tt.winStart) || !winEnd.Equal(tt.winEnd) {
+			t.Errorf("%s: got %v %v %v", tt.res, start, winStart, winEnd)
+		}
+		// 桶必须落在窗口内
+		if start.Before(winStart) || !start.Before(winEnd) {
+			t.Errorf("%s: bucket %v outside window [%v, %v)", tt.res, start, winStart, winEnd)
+		}
+	}
+}
+
+func TestQuerySeries(t *testing.T) {
+	useTestRedis(t)
+	// 昨天 23:58，跨越小时与天的窗口，且仍在各粒度的保留期内
+	t0 := time.Now().UTC().Truncate(24 * time.Hour).Add(-2 * time.Minute)
+
+	pipe := rdb.Pipeline()
+	addSeries(pipe, KindJA4, SeriesBlocked, "fp", t0, 2)
+	addSeries(pipe, KindJA4, SeriesBlocked, "fp", t0.Add(3*time.Minute), 5)
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := QuerySeries(KindJA4, SeriesBlocked, "fp", ResMinute, t0, t0.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{2, 0, 0, 5, 0}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d", len(points), len(want))
+	}
+	for i, p := range points {
+		if p.Count != want[i] || !p.Time.Equal(t0.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("point %d = %v %d, want %v %d", i, p.Time, p.Count, t0.Add(time.Duration(i)*time.Minute), want[i])
+		}
+	}
+
+	days, err := QuerySeries(KindJA4, SeriesBlocked, "fp", ResDay, t0, t0.Add(time.Hour))
+	if err != nil || len(days) != 2 || days[0].Count != 2 || days[1].Count != 5 {
+		t.Fatalf("day series = %v, %v", days, err)
+	}
+
+	// 没有数据的指纹返回全 0
+	empty, err := QuerySeries(KindJA4, SeriesBlocked, "none", ResHour, t0, t0.Add(time.Hour))
+	if err != nil || len(empty) != 2 || empty[0].Count != 0 || empty[1].Count != 0 {
+		t.Fatalf("empty series = %v, %v", empty, err)
+	}
+}
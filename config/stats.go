@@ -0,0 +1,38 @@
+package config
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// 通用计数器：在内存中累加，随阻止事件统计任务定时通过 INCRBY 写入 Redis 键 stats:<name>
+var (
+	statsCounter   = make(map[string]int64)
+	statsCounterMu sync.Mutex
+)
+
+// IncrStat 计数加一
+func IncrStat(name string) {
+	statsCounterMu.Lock()
+	statsCounter[name]++
+	statsCounterMu.Unlock()
+}
+
+// flushStats 将计数写入 Redis，并清空内存中已统计的数据
+func flushStats() {
+	statsCounterMu.Lock()
+	data := statsCounter
+	statsCounter = make(map[string]int64)
+	statsCounterMu.Unlock()
+
+	if len(data) == 0 {
+		return
+	}
+	pipe := rdb.TxPipeline()
+	for name, count := range data {
+		pipe.IncrBy(ctx, "stats:"+name, count)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 上报统计计数失败", "err", err)
+	}
+}
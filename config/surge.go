@@ -0,0 +1,236 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// 指纹突增检测：每个上报周期（见 flushReports）统计各指纹的请求数，与滚动基线（EWMA）对比。
+//   - new:   从未出现过的指纹在本周期内占据总流量的比例超过阈值
+//   - spike: 已知指纹的请求数超过基线的若干倍
+//
+// 命中后写入审计记录 surge:audit；开启自动封禁时，new 类指纹会被加入临时黑名单。
+// 检测依赖对应算法的收集开关（config:<kind>_collection_enabled）。
+// 进程启动后的前 1/α 个周期只积累基线，两类判断都不进行：全新的 Redis 或基线清空后，
+// 第一个周期里所有指纹都不在 <kind>:collected 中，否则占比最高的正常浏览器指纹会被当作 new 封禁。
+const (
+	surgeAuditKey    = "surge:audit"
+	surgeAuditMaxLen = 1000
+	surgeEWMAAlpha   = 0.1
+
+	// minSurgeCooldown 为告警冷却时长的最小值；SETNX 的过期时间为 0 时冷却键永不过期，该指纹此后不再告警
+	minSurgeCooldown = time.Minute
+)
+
+var (
+	enableSurgeDetect            = false
+	enableSurgeAutoBlock         = false
+	surgeMinHits         int64   = 200
+	surgeMinShare        float64 = 0.3
+	surgeSpikeFactor     float64 = 10
+	surgeBlockTTL                = 30 * time.Minute
+	surgeCooldown                = time.Hour
+
+	// surgeBaseline 存储 map[类型]map[指纹]每周期平均请求数
+	surgeBaseline   = make(map[string]map[string]float64)
+	surgePeriods    = make(map[string]int)
+	surgeBaselineMu sync.Mutex
+)
+
+// SurgeEvent 为一条突增审计记录
+type SurgeEvent struct {
+	Time        int64   `json:"time"`
+	Kind        string  `json:"kind"`
+	Fingerprint string  `json:"fingerprint"`
+	Reason      string  `json:"reason"`
+	Hits        int     `json:"hits"`
+	Total       int     `json:"total"`
+	Baseline    float64 `json:"baseline"`
+	AutoBlocked bool    `json:"auto_blocked"`
+	BlockTTL    int64   `json:"block_ttl,omitempty"`
+}
+
+func refreshSurgeFlags() {
+	_enableSurgeDetect, _ := getBool("config:surge_detect_enabled", enableSurgeDetect)
+	_enableSurgeAutoBlock, _ := getBool("config:surge_autoblock_enabled", enableSurgeAutoBlock)
+	_surgeMinHits, _ := getInt("config:surge_min_hits", surgeMinHits)
+	_surgeMinShare, _ := getFloat("config:surge_min_share", surgeMinShare)
+	_surgeSpikeFactor, _ := getFloat("config:surge_spike_factor", surgeSpikeFactor)
+	_surgeBlockTTL, _ := getInt("config:surge_block_ttl_seconds", int64(surgeBlockTTL/time.Second))
+	_surgeCooldown, _ := getInt("config:surge_cooldown_seconds", int64(surgeCooldown/time.Second))
+	if cooldown := time.Duration(_surgeCooldown) * time.Second; cooldown < minSurgeCooldown {
+		slog.Warn("[WARN] 突增告警冷却时长过小，使用最小值", "cooldown", _surgeCooldown, "min", int64(minSurgeCooldown/time.Second))
+		_surgeCooldown = int64(minSurgeCooldown / time.Second)
+	}
+
+	mu.Lock()
+	enableSurgeDetect = _enableSurgeDetect
+	enableSurgeAutoBlock = _enableSurgeAutoBlock
+	surgeMinHits = _surgeMinHits
+	surgeMinShare = _surgeMinShare
+	surgeSpikeFactor = _surgeSpikeFactor
+	surgeBlockTTL = time.Duration(_surgeBlockTTL) * time.Second
+	surgeCooldown = time.Duration(_surgeCooldown) * time.Second
+	mu.Unlock()
+}
+
+// isWhitelisted 判断指纹是否在对应白名单中，白名单指纹不会被自动封禁
+func isWhitelisted(kind, fp string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	switch kind {
+	case KindJA3:
+		return ja3Whitelist[fp]
+	case KindJA3N:
+		return ja3nWhitelist[fp]
+	case KindJA4:
+		return ja4Whitelist[fp]
+	}
+	return false
+}
+
+// detectSurge 对一个上报周期的计数进行突增检测，需在计数写入 <kind>:collected 之前调用
+func detectSurge(kind string, counts map[string]int) {
+	mu.RLock()
+	enabled, autoBlock := enableSurgeDetect, enableSurgeAutoBlock
+	minHits, minShare, factor := surgeMinHits, surgeMinShare, surgeSpikeFactor
+	blockTTL, cooldown := surgeBlockTTL, surgeCooldown
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	total := 0
+	var candidates []string
+	for fp, n := range counts {
+		total += n
+		if int64(n) >= minHits {
+			candidates = append(candidates, fp)
+		}
+	}
+
+	// 先取基线快照，再更新基线，保证本周期的数据不影响判断
+	baseline, warmedUp := updateSurgeBaseline(kind, counts, candidates)
+
+	if !warmedUp || len(candidates) == 0 {
+		return
+	}
+
+	members := make([]interface{}, len(candidates))
+	for i, fp := range candidates {
+		members[i] = fp
+	}
+	seen, err := rdb.SMIsMember(ctx, kind+":collected", members...).Result()
+	if err != nil {
+		slog.Warn("[WARN] 突增检测读取已收集指纹失败", "kind", kind, "err", err)
+		return
+	}
+
+	now := time.Now()
+	for i, fp := range candidates {
+		hits := counts[fp]
+		event := SurgeEvent{
+			Time:        now.Unix(),
+			Kind:        kind,
+			Fingerprint: fp,
+			Hits:        hits,
+			Total:       total,
+			Baseline:    math.Round(baseline[fp]*100) / 100,
+		}
+
+		switch {
+		case !seen[i] && baseline[fp] == 0 && float64(hits) >= minShare*float64(total):
+			event.Reason = "new"
+		case baseline[fp] > 0 && float64(hits) >= factor*baseline[fp]:
+			event.Reason = "spike"
+		default:
+			continue
+		}
+
+		// 冷却期内不重复告警，使用 Redis 键保证多实例间共享
+		cooldownKey := fmt.Sprintf("surge:cooldown:%s:%s", kind, fp)
+		if ok, err := rdb.SetNX(ctx, cooldownKey, now.Unix(), cooldown).Result(); err != nil || !ok {
+			continue
+		}
+
+		if autoBlock && event.Reason == "new" && !isWhitelisted(kind, fp) {
+			if err := AddTempBlock(kind, fp, blockTTL); err != nil {
+				slog.Warn("[WARN] 突增指纹自动封禁失败", "kind", kind, "fp", fp, "err", err)
+			} else {
+				event.AutoBlocked = true
+				event.BlockTTL = int64(blockTTL / time.Second)
+			}
+		}
+
+		recordSurgeEvent(event)
+	}
+}
+
+// updateSurgeBaseline 用本周期计数更新 EWMA 基线，返回更新前候选指纹的基线值，
+// 以及基线是否已经过足够的周期（进程刚启动时基线偏低，不做 spike 判断）
+func updateSurgeBaseline(kind string, counts map[string]int, candidates []string) (map[string]float64, bool) {
+	surgeBaselineMu.Lock()
+	defer surgeBaselineMu.Unlock()
+
+	m := surgeBaseline[kind]
+	if m == nil {
+		m = make(map[string]float64)
+		surgeBaseline[kind] = m
+	}
+
+	snapshot := make(map[string]float64, len(candidates))
+	for _, fp := range candidates {
+		snapshot[fp] = m[fp]
+	}
+
+	for fp, avg := range m {
+		avg = avg * (1 - surgeEWMAAlpha)
+		if _, ok := counts[fp]; !ok && avg < 0.01 {
+			delete(m, fp)
+			continue
+		}
+		m[fp] = avg
+	}
+	for fp, n := range counts {
+		m[fp] += surgeEWMAAlpha * float64(n)
+	}
+	surgePeriods[kind]++
+	return snapshot, float64(surgePeriods[kind]) > 1/surgeEWMAAlpha
+}
+
+func recordSurgeEvent(event SurgeEvent) {
+	slog.Warn("[SURGE] 指纹流量突增", "kind", event.Kind, "fp", event.Fingerprint, "reason", event.Reason,
+		"hits", event.Hits, "total", event.Total, "baseline", event.Baseline, "autoBlocked", event.AutoBlocked)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, surgeAuditKey, data)
+	pipe.LTrim(ctx, surgeAuditKey, 0, surgeAuditMaxLen-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("[WARN] 写入突增审计记录失败", "err", err)
+	}
+}
+
+// ListSurgeEvents 返回最近的突增审计记录（按时间倒序）
+func ListSurgeEvents(limit int64) ([]SurgeEvent, error) {
+	list, err := rdb.LRange(ctx, surgeAuditKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]SurgeEvent, 0, len(list))
+	for _, v := range list {
+		var e SurgeEvent
+		if err := json.Unmarshal([]byte(v), &e); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
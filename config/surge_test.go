@@ -0,0 +1,110 @@
+package config
+
+import "testing"
+
+// useSurgeConfig 开启突增检测并清空基线，测试结束后恢复
+func useSurgeConfig(t *testing.T, autoBlock bool) {
+	t.Helper()
+	mu.Lock()
+	oldEnabled, oldAutoBlock, oldMinHits, oldMinShare := enableSurgeDetect, enableSurgeAutoBlock, surgeMinHits, surgeMinShare
+	enableSurgeDetect, enableSurgeAutoBlock, surgeMinHits, surgeMinShare = true, autoBlock, 100, 0.3
+	mu.Unlock()
+	surgeBaselineMu.Lock()
+	oldBaseline, oldPeriods := surgeBaseline, surgePeriods
+	surgeBaseline, surgePeriods = make(map[string]map[string]float64), make(map[string]int)
+	surgeBaselineMu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		enableSurgeDetect, enableSurgeAutoBlock, surgeMinHits, surgeMinShare = oldEnabled, oldAutoBlock, oldMinHits, oldMinShare
+		mu.Unlock()
+		surgeBaselineMu.Lock()
+		surgeBaseline, surgePeriods = oldBaseline, oldPeriods
+		surgeBaselineMu.Unlock()
+	})
+}
+
+func TestUpdateSurgeBaseline(t *testing.T) {
+	useSurgeConfig(t, false)
+
+	snapshot, warmedUp := updateSurgeBaseline(KindJA4, map[string]int{"a": 100}, []string{"a"})
+	if snapshot["a"] != 0 || warmedUp {
+		t.Fatalf("first period: snapshot=%v warmedUp=%v", snapshot, warmedUp)
+	}
+	snapshot, _ = updateSurgeBaseline(KindJA4, map[string]int{"b": 1}, []string{"a"})
+	// 本周期的数据不影响返回的快照：a 在第一个周期后为 0.1*100
+	if snapshot["a"] != 10 {
+		t.Fatalf("snapshot[a] = %v, want 10", snapshot["a"])
+	}
+	for i := 0; i < 8; i++ {
+		if _, warmedUp = updateSurgeBaseline(KindJA4, nil, nil); warmedUp {
+			t.Fatalf("warmed up after %d periods", i+3)
+		}
+	}
+	if _, warmedUp = updateSurgeBaseline(KindJA4, nil, nil); !warmedUp {
+		t.Fatal("expected warmed up after 1/alpha periods")
+	}
+
+	// 长期不出现的指纹衰减到阈值以下后删除
+	for i := 0; i < 30; i++ {
+		updateSurgeBaseline(KindJA4, nil, nil)
+	}
+	surgeBaselineMu.Lock()
+	_, ok := surgeBaseline[KindJA4]["b"]
+	surgeBaselineMu.Unlock()
+	if ok {
+		t.Error("decayed fingerprint should be removed from the baseline")
+	}
+}
+
+func TestDetectSurge(t *testing.T) {
+	useTestRedis(t)
+	useTempBlocks(t)
+	useSurgeConfig(t, true)
+
+	// 全新的 Redis 上第一个周期所有指纹都未收集过，不应把主流浏览器指纹当作 new 封禁
+	detectSurge(KindJA4, map[string]int{"browser": 900, "other": 100})
+	if n, _ := rdb.ZCard(ctx, tempBlockKey(KindJA4)).Result(); n != 0 {
+		t.Fatalf("auto-blocked %d fingerprints before warm-up", n)
+	}
+	rdb.SAdd(ctx, KindJA4+":collected", "browser", "other")
+	for i := 0; i < 10; i++ {
+		detectSurge(KindJA4, map[string]int{"browser": 900, "other": 100})
+	}
+	if n, _ := rdb.LLen(ctx, surgeAuditKey).Result(); n != 0 {
+		t.Fatalf("%d surge events during steady traffic", n)
+	}
+
+	// 未收集过的指纹占比超过阈值：new，自动封禁
+	detectSurge(KindJA4, map[string]int{"browser": 900, "bot": 600})
+	// 已知指纹超过基线 10 倍：spike，不封禁
+	detectSurge(KindJA4, map[string]int{"browser": 900, "other": 5000})
+
+	events, err := ListSurgeEvents(10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	spike, fresh := events[0], events[1]
+	if fresh.Fingerprint != "bot" || fresh.Reason != "new" || !fresh.AutoBlocked {
+		t.Errorf("new event = %+v", fresh)
+	}
+	if spike.Fingerprint != "other" || spike.Reason != "spike" || spike.AutoBlocked {
+		t.Errorf("spike event = %+v", spike)
+	}
+
+	// 冷却期内不重复告警
+	detectSurge(KindJA4, map[string]int{"browser": 900, "bot": 600})
+	if n, _ := rdb.LLen(ctx, surgeAuditKey).Result(); n != 2 {
+		t.Errorf("%d events, want 2 during cooldown", n)
+	}
+
+	// 自动封禁在关闭 ja4_check_enabled 时同样生效
+	if err := refreshTempBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if EnableJA4Check() || !ShouldBlockJA4("bot") || ShouldBlockJA4("browser") {
+		t.Error("auto-blocked fingerprint should be blocked with the ja4 check disabled")
+	}
+	if remaining := TempBlockRemaining(KindJA4, "bot"); remaining <= 0 || remaining > surgeBlockTTL {
+		t.Errorf("TempBlockRemaining = %v", remaining)
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import "time"
+
+var (
+	// tarpit：保持被阻止的连接 tarpitDuration，每隔 tarpitInterval 发送一个字节，
+	// 同时处于 tarpit 中的连接超过 tarpitMaxConns 时改为直接关闭
+	tarpitDuration       = 5 * time.Minute
+	tarpitInterval       = 10 * time.Second
+	tarpitMaxConns int64 = 10000
+)
+
+// TarpitConfig 为 tarpit 的参数
+type TarpitConfig struct {
+	Duration time.Duration
+	Interval time.Duration
+	MaxConns int64
+}
+
+func refreshTarpitFlags() {
+	_tarpitDuration, _ := getInt("config:tarpit_duration_seconds", int64(tarpitDuration/time.Second))
+	_tarpitInterval, _ := getInt("config:tarpit_interval_ms", int64(tarpitInterval/time.Millisecond))
+	_tarpitMaxConns, _ := getInt("config:tarpit_max_conns", tarpitMaxConns)
+
+	mu.Lock()
+	tarpitDuration = time.Duration(_tarpitDuration) * time.Second
+	tarpitInterval = time.Duration(_tarpitInterval) * time.Millisecond
+	tarpitMaxConns = _tarpitMaxConns
+	mu.Unlock()
+}
+
+// GetTarpitConfig 返回 tarpit 的参数
+func GetTarpitConfig() TarpitConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	return TarpitConfig{Duration: tarpitDuration, Interval: tarpitInterval, MaxConns: tarpitMaxConns}
+}
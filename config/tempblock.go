@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 临时封禁的对象类型，对应 Redis 键前缀
+const (
+	KindJA3  = "ja3"
+	KindJA3N = "ja3n"
+	KindJA4  = "ja4"
+	KindIP   = "ip"
+)
+
+// 临时封禁使用有序集合 <类型>:tempblock 存储，成员为指纹或 IP，score 为到期时间（Unix 秒）。
+// 例如封禁 30 分钟：ZADD ja4:tempblock <now+1800> <ja4>，也可直接调用 AddTempBlock。
+var (
+	tempBlockKinds = []string{KindJA3, KindJA3N, KindJA4, KindIP}
+
+	// tempBlocks 存储 map[类型]map[成员]到期时间，由 mu 保护
+	tempBlocks = make(map[string]map[string]int64)
+)
+
+func tempBlockKey(kind string) string {
+	return kind + ":tempblock"
+}
+
+// loadTempBlocks 清理已过期成员，并加载仍然有效的临时封禁
+func loadTempBlocks(kind string) (map[string]int64, error) {
+	key := tempBlockKey(kind)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := rdb.ZRemRangeByScore(ctx, key, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	list, err := rdb.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "(" + now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]int64, len(list))
+	for _, z := range list {
+		if member, ok := z.Member.(string); ok {
+			m[member] = int64(z.Score)
+		}
+	}
+	return m, nil
+}
+
+func refreshTempBlocks() error {
+	var firstErr error
+	_tempBlocks := make(map[string]map[string]int64, len(tempBlockKinds))
+	for _, kind := range tempBlockKinds {
+		m, err := loadTempBlocks(kind)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			// 加载失败时保留当前数据
+			mu.RLock()
+			m = tempBlocks[kind]
+			mu.RUnlock()
+		}
+		_tempBlocks[kind] = m
+	}
+
+	mu.Lock()
+	tempBlocks = _tempBlocks
+	mu.Unlock()
+	return firstErr
+}
+
+// tempBlockedLocked 判断成员是否处于临时封禁中，调用方需持有 mu
+func tempBlockedLocked(kind, value string) bool {
+	expireAt, ok := tempBlocks[kind][value]
+	return ok && expireAt > time.Now().Unix()
+}
+
+// AddTempBlock 临时封禁指纹或 IP，ttl 到期后自动解除。
+// 重复封禁同一成员时只会延长到期时间，不会缩短。
+func AddTempBlock(kind, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("临时封禁时长必须大于 0")
+	}
+	expireAt := time.Now().Add(ttl).Unix()
+	err := rdb.ZAddGT(ctx, tempBlockKey(kind), redis.Z{Score: float64(expireAt), Member: value}).Err()
+	if err != nil {
+		return err
+	}
+
+	// 立即在本地生效，无需等待下一次 refreshLists
+	mu.Lock()
+	if tempBlocks[kind] == nil {
+		tempBlocks[kind] = make(map[string]int64)
+	}
+	if tempBlocks[kind][value] < expireAt {
+		tempBlocks[kind][value] = expireAt
+	}
+	mu.Unlock()
+	return nil
+}
+
+// RemoveTempBlock 提前解除临时封禁
+func RemoveTempBlock(kind, value string) error {
+	if err := rdb.ZRem(ctx, tempBlockKey(kind), value).Err(); err != nil {
+		return err
+	}
+	mu.Lock()
+	delete(tempBlocks[kind], value)
+	mu.Unlock()
+	return nil
+}
+
+// HasTempBlocks 判断某种类型是否有生效中的临时封禁，用于在关闭检查时决定是否仍需计算指纹
+func HasTempBlocks(kind string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(tempBlocks[kind]) > 0
+}
+
+// TempBlockRemaining 返回临时封禁的剩余时间，未处于临时封禁时返回 0
+func TempBlockRemaining(kind, value string) time.Duration {
+	mu.RLock()
+	expireAt, ok := tempBlocks[kind][value]
+	mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(time.Unix(expireAt, 0))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// ListTempBlocks 从 Redis 读取某类型当前所有临时封禁及其剩余时间
+func ListTempBlocks(kind string) (map[string]time.Duration, error) {
+	m, err := loadTempBlocks(kind)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]time.Duration, len(m))
+	for member, expireAt := range m {
+		result[member] = time.Until(time.Unix(expireAt, 0)).Round(time.Second)
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// useTempBlocks 清空本地临时封禁，测试结束后恢复
+func useTempBlocks(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	old := tempBlocks
+	tempBlocks = make(map[string]map[string]int64)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		tempBlocks = old
+		mu.Unlock()
+	})
+}
+
+func TestAddTempBlock(t *testing.T) {
+	s := useTestRedis(t)
+	useTempBlocks(t)
+
+	if err := AddTempBlock(KindIP, "192.0.2.1", 0); err == nil {
+		t.Error("AddTempBlock should reject a non-positive ttl")
+	}
+	if err := AddTempBlock(KindIP, "192.0.2.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := TempBlockRemaining(KindIP, "192.0.2.1"); remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Errorf("TempBlockRemaining = %v, want about 1h", remaining)
+	}
+	if TempBlockRemaining(KindIP, "192.0.2.2") != 0 {
+		t.Error("unblocked IP should have no remaining time")
+	}
+
+	// 再次封禁更短的时间不会缩短已有的封禁，Redis 与本地均保持较晚的到期时间
+	if err := AddTempBlock(KindIP, "192.0.2.1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	score, err := s.ZScore(tempBlockKey(KindIP), "192.0.2.1")
+	if err != nil || int64(score) < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("ip:tempblock score = %v, %v, want about now+1h", score, err)
+	}
+	if remaining := TempBlockRemaining(KindIP, "192.0.2.1"); remaining <= 59*time.Minute {
+		t.Errorf("TempBlockRemaining = %v after a shorter block", remaining)
+	}
+
+	// 更长的封禁会延长到期时间
+	if err := AddTempBlock(KindIP, "192.0.2.1", 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := TempBlockRemaining(KindIP, "192.0.2.1"); remaining <= time.Hour {
+		t.Errorf("TempBlockRemaining = %v after a longer block", remaining)
+	}
+}
+
+func TestRefreshTempBlocksExpiry(t *testing.T) {
+	s := useTestRedis(t)
+	useTempBlocks(t)
+
+	now := time.Now().Unix()
+	s.ZAdd(tempBlockKey(KindJA4), float64(now-10), "fp-expired")
+	s.ZAdd(tempBlockKey(KindJA4), float64(now+600), "fp-active")
+
+	if err := refreshTempBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if !HasTempBlocks(KindJA4) || HasTempBlocks(KindJA3) {
+		t.Error("HasTempBlocks should only report ja4")
+	}
+	if TempBlockRemaining(KindJA4, "fp-expired") != 0 || TempBlockRemaining(KindJA4, "fp-active") <= 0 {
+		t.Error("only fp-active should be blocked")
+	}
+	// 已过期的成员从 Redis 中删除
+	if members, _ := s.ZMembers(tempBlockKey(KindJA4)); len(members) != 1 || members[0] != "fp-active" {
+		t.Errorf("ja4:tempblock = %v, want [fp-active]", members)
+	}
+
+	list, err := ListTempBlocks(KindJA4)
+	if remaining := list["fp-active"]; err != nil || len(list) != 1 || remaining < 9*time.Minute || remaining > 10*time.Minute {
+		t.Errorf("ListTempBlocks = %v, %v", list, err)
+	}
+
+	if err := RemoveTempBlock(KindJA4, "fp-active"); err != nil {
+		t.Fatal(err)
+	}
+	if HasTempBlocks(KindJA4) || s.Exists(tempBlockKey(KindJA4)) {
+		t.Error("RemoveTempBlock should clear the local and Redis entries")
+	}
+}
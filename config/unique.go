@@ -0,0 +1,95 @@
+package config
+
+import (
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 每个指纹的不同客户端 IP 与 SNI 个数用 HyperLogLog 估算，随上报任务批量写入：
+//   - <kind>:hll:ip:<fp>   客户端 IP
+//   - <kind>:hll:sni:<fp>  SNI，未携带 SNI 的连接不计入
+//
+// 区分“一个爬虫反复连接”与“大量浏览器使用同一指纹”。过期指纹清理时一并删除
+func uniqueIPKey(kind, fp string) string  { return kind + ":hll:ip:" + fp }
+func uniqueSNIKey(kind, fp string) string { return kind + ":hll:sni:" + fp }
+
+// addUnique 把一个上报周期的 IP 与 SNI 按指纹合并后写入 HyperLogLog
+func addUnique(pipe redis.Pipeliner, kind string, ips, snis map[[2]string]struct{}) {
+	pfadd := func(keyFn func(kind, fp string) string, set map[[2]string]struct{}) {
+		byFP := make(map[string][]interface{})
+		for k := range set {
+			byFP[k[0]] = append(byFP[k[0]], k[1])
+		}
+		for fp, values := range byFP {
+			pipe.PFAdd(ctx, keyFn(kind, fp), values...)
+		}
+	}
+	pfadd(uniqueIPKey, ips)
+	pfadd(uniqueSNIKey, snis)
+}
+
+// deleteUnique 删除过期指纹的 HyperLogLog
+func deleteUnique(kind string, fps []string) {
+	if len(fps) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(fps)*2)
+	for _, fp := range fps {
+		keys = append(keys, uniqueIPKey(kind, fp), uniqueSNIKey(kind, fp))
+	}
+	if err := rdb.Del(ctx, keys...).Err(); err != nil {
+		slog.Warn("[WARN] 清理指纹 HyperLogLog 失败", "kind", kind, "err", err)
+	}
+}
+
+// FingerprintStat 为一个指纹的采集统计，DistinctIPs 与 DistinctSNIs 为 HyperLogLog 估算值（误差约 0.81%）
+type FingerprintStat struct {
+	Fingerprint  string `json:"fingerprint"`
+	Count        int64  `json:"count"`
+	LastSeen     int64  `json:"last_seen"`
+	DistinctIPs  int64  `json:"distinct_ips"`
+	DistinctSNIs int64  `json:"distinct_snis"`
+}
+
+// GetFingerprintStats 返回指定指纹的采集统计，未采集到的指纹各项为 0
+func GetFingerprintStats(kind string, fps ...string) ([]FingerprintStat, error) {
+	type cmds struct {
+		count, lastSeen *redis.FloatCmd
+		ips, snis       *redis.IntCmd
+	}
+	pipe := rdb.Pipeline()
+	results := make([]cmds, len(fps))
+	for i, fp := range fps {
+		results[i] = cmds{
+			count:    pipe.ZScore(ctx, kind+":count", fp),
+			lastSeen: pipe.ZScore(ctx, kind+":last_seen", fp),
+			ips:      pipe.PFCount(ctx, uniqueIPKey(kind, fp)),
+			snis:     pipe.PFCount(ctx, uniqueSNIKey(kind, fp)),
+		}
+	}
+	// 指纹不存在时 ZSCORE 返回 redis.Nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	stats := make([]FingerprintStat, len(fps))
+	for i, fp := range fps {
+		stats[i] = FingerprintStat{
+			Fingerprint:  fp,
+			Count:        int64(results[i].count.Val()),
+			LastSeen:     int64(results[i].lastSeen.Val()),
+			DistinctIPs:  results[i].ips.Val(),
+			DistinctSNIs: results[i].snis.Val(),
+		}
+	}
+	return stats, nil
+}
+
+// TopFingerprints 返回连接次数最多的 limit 个指纹及其统计
+func TopFingerprints(kind string, limit int64) ([]FingerprintStat, error) {
+	fps, err := rdb.ZRevRange(ctx, kind+":count", 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return GetFingerprintStats(kind, fps...)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintStats(t *testing.T) {
+	useTestRedis(t)
+	var r fingerprintReport
+	for _, s := range []ClientSample{
+		{IP: "192.0.2.1", SNI: "a.example"},
+		{IP: "192.0.2.2", SNI: "a.example"},
+		{IP: "192.0.2.2", SNI: "b.example"},
+	} {
+		r.add("fp-a", s)
+	}
+	r.add("fp-b", ClientSample{IP: "192.0.2.9"})
+	now := time.Now()
+	flushFingerprintReports(KindJA4, map[string]int{"fp-a": 3, "fp-b": 1}, r.take(), now)
+
+	// 未采集到的指纹 ZSCORE 返回 redis.Nil，各项为 0
+	stats, err := GetFingerprintStats(KindJA4, "fp-a", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FingerprintStat{Fingerprint: "fp-a", Count: 3, LastSeen: now.Unix(), DistinctIPs: 2, DistinctSNIs: 2}
+	if stats[0] != want {
+		t.Errorf("fp-a = %+v, want %+v", stats[0], want)
+	}
+	if stats[1] != (FingerprintStat{Fingerprint: "missing"}) {
+		t.Errorf("missing = %+v", stats[1])
+	}
+
+	top, err := TopFingerprints(KindJA4, 1)
+	if err != nil || len(top) != 1 || top[0].Fingerprint != "fp-a" {
+		t.Fatalf("TopFingerprints = %+v, %v", top, err)
+	}
+	if top, err := TopFingerprints(KindJA3, 10); err != nil || len(top) != 0 {
+		t.Fatalf("TopFingerprints(empty) = %+v, %v", top, err)
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// 负载均衡策略
+const (
+	LBRoundRobin     = "roundrobin"
+	LBLeastConn      = "leastconn"
+	LBConsistentHash = "hash"
+)
+
+// 上游池：哈希 upstream:pool，字段为 host:port，值为权重（1 到 maxUpstreamWeight 的整数）。
+// 为空时使用启动参数 -target 指定的地址。
+const upstreamPoolKey = "upstream:pool"
+
+// maxUpstreamWeight 为权重上限，一致性哈希环的虚拟节点数与权重成正比
+const maxUpstreamWeight = 100
+
+var (
+	upstreamPool = make(map[string]int)
+
+	lbPolicy        = LBRoundRobin
+	lbHashKey       = KindIP // 一致性哈希的键：ip、ja4 或 ja3n
+	dialRetry int64 = 1
+
+	// 主动健康检查：每隔 interval 连接一次（tcp 或 tls），连续失败 fall 次标记为不可用，连续成功 rise 次恢复
+	enableHealthCheck         = true
+	healthCheckMode           = "tcp"
+	healthCheckSNI            = ""
+	healthCheckInterval int64 = 5000
+	healthCheckTimeout  int64 = 1000
+	healthCheckFall     int64 = 3
+	healthCheckRise     int64 = 2
+
+	// 被动摘除：连续 outlierFailures 次连接失败后摘除 outlierEjection 秒
+	outlierFailures int64 = 5
+	outlierEjection int64 = 30
+)
+
+// LBConfig 为负载均衡与健康检查的参数
+type LBConfig struct {
+	Policy    string
+	HashKey   string
+	DialRetry int
+
+	HealthCheck         bool
+	HealthCheckMode     string
+	HealthCheckSNI      string
+	HealthCheckInterval int64 // 毫秒
+	HealthCheckTimeout  int64 // 毫秒
+	HealthCheckFall     int
+	HealthCheckRise     int
+
+	OutlierFailures int
+	OutlierEjection int64 // 秒
+}
+
+func refreshLBFlags() {
+	_lbPolicy, _ := getString("config:lb_policy", lbPolicy)
+	_lbHashKey, _ := getString("config:lb_hash_key", lbHashKey)
+	_dialRetry, _ := getInt("config:dial_retries", dialRetry)
+	_enableHealthCheck, _ := getBool("config:healthcheck_enabled", enableHealthCheck)
+	_healthCheckMode, _ := getString("config:healthcheck_mode", healthCheckMode)
+	_healthCheckSNI, _ := getOptionalString("config:healthcheck_sni")
+	_healthCheckInterval, _ := getInt("config:healthcheck_interval_ms", healthCheckInterval)
+	_healthCheckTimeout, _ := getInt("config:healthcheck_timeout_ms", healthCheckTimeout)
+	_healthCheckFall, _ := getInt("config:healthcheck_fall", healthCheckFall)
+	_healthCheckRise, _ := getInt("config:healthcheck_rise", healthCheckRise)
+	_outlierFailures, _ := getInt("config:outlier_consecutive_failures", outlierFailures)
+	_outlierEjection, _ := getInt("config:outlier_ejection_seconds", outlierEjection)
+
+	switch _lbPolicy {
+	case LBRoundRobin, LBLeastConn, LBConsistentHash:
+	default:
+		slog.Warn("[WARN] 未知的负载均衡策略，使用 roundrobin", "policy", _lbPolicy)
+		_lbPolicy = LBRoundRobin
+	}
+
+	mu.Lock()
+	lbPolicy = _lbPolicy
+	lbHashKey = _lbHashKey
+	dialRetry = _dialRetry
+	enableHealthCheck = _enableHealthCheck
+	healthCheckMode = _healthCheckMode
+	healthCheckSNI = _healthCheckSNI
+	healthCheckInterval = _healthCheckInterval
+	healthCheckTimeout = _healthCheckTimeout
+	healthCheckFall = _healthCheckFall
+	healthCheckRise = _healthCheckRise
+	outlierFailures = _outlierFailures
+	outlierEjection = _outlierEjection
+	mu.Unlock()
+}
+
+// GetLBConfig 返回负载均衡与健康检查的参数
+func GetLBConfig() LBConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	return LBConfig{
+		Policy:              lbPolicy,
+		HashKey:             lbHashKey,
+		DialRetry:           int(dialRetry),
+		HealthCheck:         enableHealthCheck,
+		HealthCheckMode:     healthCheckMode,
+		HealthCheckSNI:      healthCheckSNI,
+		HealthCheckInterval: healthCheckInterval,
+		HealthCheckTimeout:  healthCheckTimeout,
+		HealthCheckFall:     int(healthCheckFall),
+		HealthCheckRise:     int(healthCheckRise),
+		OutlierFailures:     int(outlierFailures),
+		OutlierEjection:     outlierEjection,
+	}
+}
+
+// LBHashUses 判断一致性哈希是否使用某个维度，用于决定是否需要计算对应指纹
+func LBHashUses(kind string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return lbPolicy == LBConsistentHash && lbHashKey == kind
+}
+
+func refreshUpstreamPool() error {
+	m, err := rdb.HGetAll(ctx, upstreamPoolKey).Result()
+	if err != nil {
+		return err
+	}
+	_upstreamPool := make(map[string]int, len(m))
+	for addr, v := range m {
+		weight, err := strconv.Atoi(v)
+		if err != nil || weight <= 0 {
+			slog.Warn("[WARN] 上游权重无效，忽略", "addr", addr, "weight", v)
+			continue
+		}
+		if weight > maxUpstreamWeight {
+			slog.Warn("[WARN] 上游权重超过上限，使用最大值", "addr", addr, "weight", weight, "max", maxUpstreamWeight)
+			weight = maxUpstreamWeight
+		}
+		_upstreamPool[addr] = weight
+	}
+
+	mu.Lock()
+	upstreamPool = _upstreamPool
+	mu.Unlock()
+	return nil
+}
+
+// UpstreamPool 返回上游池成员及其权重，未配置时返回空
+func UpstreamPool() map[string]int {
+	mu.RLock()
+	defer mu.RUnlock()
+	m := make(map[string]int, len(upstreamPool))
+	for addr, weight := range upstreamPool {
+		m[addr] = weight
+	}
+	return m
+}
+
+// AddUpstream 添加或更新上游池成员
+func AddUpstream(addr string, weight int) error {
+	if weight <= 0 || weight > maxUpstreamWeight {
+		return fmt.Errorf("权重必须在 1 到 %d 之间", maxUpstreamWeight)
+	}
+	if err := rdb.HSet(ctx, upstreamPoolKey, addr, weight).Err(); err != nil {
+		return err
+	}
+	mu.Lock()
+	upstreamPool[addr] = weight
+	mu.Unlock()
+	return nil
+}
+
+// RemoveUpstream 从上游池中移除成员
+func RemoveUpstream(addr string) error {
+	if err := rdb.HDel(ctx, upstreamPoolKey, addr).Err(); err != nil {
+		return err
+	}
+	mu.Lock()
+	delete(upstreamPool, addr)
+	mu.Unlock()
+	return nil
+}
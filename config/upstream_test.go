@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestRefreshUpstreamPoolWeight(t *testing.T) {
+	s := useTestRedis(t)
+	s.HSet(upstreamPoolKey, "a:443", "5", "b:443", "100000", "c:443", "0", "d:443", "x")
+	mu.Lock()
+	old := upstreamPool
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		upstreamPool = old
+		mu.Unlock()
+	})
+
+	if err := refreshUpstreamPool(); err != nil {
+		t.Fatal(err)
+	}
+	pool := UpstreamPool()
+	if len(pool) != 2 || pool["a:443"] != 5 || pool["b:443"] != maxUpstreamWeight {
+		t.Errorf("UpstreamPool = %v", pool)
+	}
+
+	if err := AddUpstream("e:443", maxUpstreamWeight+1); err == nil {
+		t.Error("AddUpstream should reject weights above the maximum")
+	}
+	if err := AddUpstream("e:443", 0); err == nil {
+		t.Error("AddUpstream should reject non-positive weights")
+	}
+}
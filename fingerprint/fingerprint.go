@@ -22,28 +22,40 @@ import (
 
 // JA4Fingerprint is a FingerprintFunc
 func JA4Fingerprint(data *[]byte) (string, error) {
-	fp := &ja4.JA4Fingerprint{}
-	err := fp.UnmarshalBytes(*data, 't') // TODO: identify connection protocol
+	fp, _, err := JA4FingerprintRaw(data)
+	return fp, err
+}
+
+// JA4FingerprintRaw 返回 JA4 指纹及其未哈希的原始形式（JA4_r）
+func JA4FingerprintRaw(data *[]byte) (fp string, raw string, err error) {
+	j := &ja4.JA4Fingerprint{}
+	err = j.UnmarshalBytes(*data, 't') // TODO: identify connection protocol
 	if err != nil {
-		return "", fmt.Errorf("ja4: %w", err)
+		return "", "", fmt.Errorf("ja4: %w", err)
 	}
 
-	slog.Debug("JA4Fingerprint", "ja4", fp)
-	return fp.String(), nil
+	slog.Debug("JA4Fingerprint", "ja4", j)
+	return j.String(), j.Raw(), nil
 }
 
 // JA3Fingerprint is a FingerprintFunc
 func JA3Fingerprint(data *[]byte) (string, string, error) {
+	ja3Hash, ja3nHash, _, _, err := JA3FingerprintRaw(data)
+	return ja3Hash, ja3nHash, err
+}
+
+// JA3FingerprintRaw 返回 JA3、JA3N 指纹及计算指纹前的原始字符串
+func JA3FingerprintRaw(data *[]byte) (ja3Hash, ja3nHash, ja3Raw, ja3nRaw string, err error) {
 	hellobasic := &tlsx.ClientHelloBasic{}
 	if err := hellobasic.Unmarshal(*data); err != nil {
-		return "", "", fmt.Errorf("ja3: %w", err)
+		return "", "", "", "", fmt.Errorf("ja3: %w", err)
 	}
 
 	j := ja3.OrigString(hellobasic)
 	// JA3 字符串格式：TLSVersion,CipherSuites,Extensions,SupportedGroups,ECPointFormats
 	parts := strings.Split(j, ",")
 	if len(parts) != 5 {
-		return "", "", fmt.Errorf("JA3 字符串格式错误")
+		return "", "", "", "", fmt.Errorf("JA3 字符串格式错误")
 	}
 	// 对 Extensions 部分进行排序（如果非空）
 	extField := parts[2]
@@ -64,5 +76,5 @@ func JA3Fingerprint(data *[]byte) (string, string, error) {
 	fp := ja3.DigestHex(hellobasic)
 
 	slog.Debug("JA3Fingerprint", "ja3", j, "ja3Hash", fp, "ja3s", ja3nStr, "ja3sHash", ja3sHash)
-	return fp, ja3sHash, nil
+	return fp, ja3sHash, j, ja3nStr, nil
 }
@@ -80,16 +80,6 @@ func (j *JA4Fingerprint) Unmarshal(chs *utls.ClientHelloSpec, protocol byte) err
 }
 
 func (j *JA4Fingerprint) String() string {
-	ja4a := fmt.Sprintf(
-		"%s%s%s%s%s%s",
-		string(j.Protocol),
-		j.TLSVersion,
-		string(j.SNI),
-		j.NumberOfCipherSuites,
-		j.NumberOfExtensions,
-		j.FirstALPN,
-	)
-
 	ja4b := truncatedSha256(j.CipherSuites.String())
 
 	var ja4c string
@@ -99,11 +89,32 @@ func (j *JA4Fingerprint) String() string {
 		ja4c = truncatedSha256(fmt.Sprintf("%s_%s", j.Extensions, j.SignatureAlgorithms))
 	}
 
-	ja4 := fmt.Sprintf("%s_%s_%s", ja4a, ja4b, ja4c)
+	ja4 := fmt.Sprintf("%s_%s_%s", j.ja4a(), ja4b, ja4c)
 
 	return ja4
 }
 
+// Raw returns the raw (unhashed) form of the fingerprint, i.e. JA4_r, ref:
+// https://github.com/FoxIO-LLC/ja4/blob/61319bfc0d0038e0a240a8ab83aef1fdd821d404/technical_details/JA4.md?plain=1#L140
+func (j *JA4Fingerprint) Raw() string {
+	if len(j.SignatureAlgorithms) == 0 {
+		return fmt.Sprintf("%s_%s_%s", j.ja4a(), j.CipherSuites, j.Extensions)
+	}
+	return fmt.Sprintf("%s_%s_%s_%s", j.ja4a(), j.CipherSuites, j.Extensions, j.SignatureAlgorithms)
+}
+
+func (j *JA4Fingerprint) ja4a() string {
+	return fmt.Sprintf(
+		"%s%s%s%s%s%s",
+		string(j.Protocol),
+		j.TLSVersion,
+		string(j.SNI),
+		j.NumberOfCipherSuites,
+		j.NumberOfExtensions,
+		j.FirstALPN,
+	)
+}
+
 func (j *JA4Fingerprint) unmarshalTLSVersion(chs *utls.ClientHelloSpec) {
 	var vers uint16
 	if chs.TLSVersMax == 0 {
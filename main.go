@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"strings"
 	"tls-proxy/config"
+	"tls-proxy/metrics"
 	"tls-proxy/proxy"
 )
 
@@ -24,12 +27,60 @@ func parseLogLevel(level string) slog.Level {
 	}
 }
 
+// startAdmin 启动管理接口，与代理监听器分开，避免对外暴露
+func startAdmin(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	registerStatsHandlers(mux)
+	slog.Info("启动管理接口", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("管理接口启动失败", "addr", addr, "err", err)
+	}
+}
+
+// parsePorts 把逗号分隔的端口列表转换为监听地址
+func parsePorts(ports string) []string {
+	var addrs []string
+	for _, port := range strings.Split(ports, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			addrs = append(addrs, ":"+port)
+		}
+	}
+	return addrs
+}
+
+// parseProtoPorts 解析 端口=协议 列表
+func parseProtoPorts(list string) (map[string]string, error) {
+	addrs := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		port, proto, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("格式应为 端口=协议: %s", item)
+		}
+		addrs[":"+strings.TrimSpace(port)] = strings.TrimSpace(proto)
+	}
+	return addrs, nil
+}
+
 func main() {
 	redisAddr := flag.String("redisaddr", "127.0.0.1:6379", "Redis 地址")
 	redisPassword := flag.String("redispass", "", "Redis 密码")
 	redisDbNum := flag.Int("redisdb", 0, "Redis Select DB")
-	listenPort := flag.Int("listen", 443, "本地监听端口")
-	targetAddr := flag.String("target", "127.0.0.1:8443", "转发目标地址")
+	listenPorts := flag.String("listen", "443", "本地监听端口，多个端口用逗号分隔")
+	targetAddr := flag.String("target", "127.0.0.1:8443", "转发目标地址，上游池 upstream:pool 为空时使用")
+	egressPorts := flag.String("egress", "", "正向代理（HTTP CONNECT / SOCKS5）监听端口，多个端口用逗号分隔，按内网源主机记录指纹")
+	starttlsPorts := flag.String("starttls", "", "STARTTLS 监听端口及协议（smtp, imap, pop3, postgres），如 25=smtp,143=imap")
+	transparent := flag.Bool("transparent", false, "透明代理模式，配合 iptables REDIRECT/TPROXY 转发到原始目标地址，忽略 -target 与上游池")
+	spoofSource := flag.Bool("spoofsource", false, "连接上游时使用客户端 IP 作为源地址（IP_TRANSPARENT）")
+	adminAddr := flag.String("admin", "", "管理接口监听地址（提供 /metrics），如 127.0.0.1:9090，为空时不启动")
+	accessLogPath := flag.String("accesslog", "", "访问日志文件，每个连接关闭时记录一行，为空时不记录")
+	accessLogFormat := flag.String("accesslogformat", "json", "访问日志格式（json, logfmt）")
+	accessLogMaxSize := flag.Int("accesslogmaxsize", 100, "访问日志单个文件的大小上限（MB），超过后轮转")
+	accessLogBackups := flag.Int("accesslogbackups", 10, "访问日志保留的旧文件个数，0 表示不限制")
+	accessLogMaxAge := flag.Int("accesslogmaxage", 7, "访问日志旧文件的保留天数，0 表示不限制")
 	logLevel := flag.String("loglevel", "info", "日志级别（debug, info, warn, error）")
 
 	flag.Usage = func() {
@@ -58,8 +109,33 @@ func main() {
 	slog.Info("启动配置模块", "RedisAddr", *redisAddr)
 	config.Init(*redisAddr, *redisPassword, *redisDbNum)
 
-	slog.Info("启动 JA3 代理服务", "listenPort", *listenPort, "targetAddr", *targetAddr)
-	err := proxy.StartProxy(fmt.Sprintf(":%d", *listenPort), *targetAddr)
+	if *adminAddr != "" {
+		go startAdmin(*adminAddr)
+	}
+
+	listenAddrs := parsePorts(*listenPorts)
+	egressAddrs := parsePorts(*egressPorts)
+	starttlsAddrs, err := parseProtoPorts(*starttlsPorts)
+	if err != nil {
+		slog.Error("STARTTLS 参数无效", "err", err)
+		os.Exit(1)
+	}
+
+	slog.Info("启动 JA3 代理服务", "listenPorts", *listenPorts, "egressPorts", *egressPorts, "targetAddr", *targetAddr, "transparent", *transparent)
+	err = proxy.StartProxy(listenAddrs, *targetAddr, proxy.Options{
+		Transparent:   *transparent,
+		SpoofSource:   *spoofSource,
+		EgressAddrs:   egressAddrs,
+		StartTLSAddrs: starttlsAddrs,
+		AccessLog: proxy.AccessLogOptions{
+			Path:       *accessLogPath,
+			Format:     *accessLogFormat,
+			MaxSizeMB:  *accessLogMaxSize,
+			MaxBackups: *accessLogBackups,
+			MaxAgeDays: *accessLogMaxAge,
+			Compress:   true,
+		},
+	})
 	if err != nil {
 		slog.Error("启动失败", "err", err)
 	}
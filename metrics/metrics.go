@@ -0,0 +1,304 @@
+// Package metrics 实现 Prometheus 文本格式的计数器、仪表盘与直方图，
+// 只覆盖本项目用到的功能，避免引入完整的客户端库。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registry   []collector
+	registryMu sync.Mutex
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+}
+
+// vec 按标签值保存时间序列
+type vec[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	series sync.Map // 标签值拼接 -> *T
+	newT   func() *T
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签值", v.name, len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	if s, ok := v.series.Load(key); ok {
+		return s.(*T)
+	}
+	s, _ := v.series.LoadOrStore(key, v.newT())
+	return s.(*T)
+}
+
+// each 按标签值排序遍历时间序列
+func (v *vec[T]) each(fn func(labels string, s *T)) {
+	var keys []string
+	v.series.Range(func(k, _ any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	for _, k := range keys {
+		s, _ := v.series.Load(k)
+		fn(formatLabels(v.labels, strings.Split(k, "\xff")), s.(*T))
+	}
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// addLabel 在已格式化的标签中追加一个标签，用于直方图的 le
+func addLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter 为单调递增的计数
+type Counter struct{ v atomic.Uint64 }
+
+func (c *Counter) Inc()          { c.v.Add(1) }
+func (c *Counter) Add(n uint64)  { c.v.Add(n) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// CounterVec 为带标签的计数器
+type CounterVec struct{ vec[Counter] }
+
+// NewCounter 注册一个计数器
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[Counter]{name: name, help: help, typ: "counter", labels: labels, newT: func() *Counter { return &Counter{} }}}
+	register(c)
+	return c
+}
+
+// With 返回标签值对应的计数，调用方可以缓存返回值
+func (c *CounterVec) With(values ...string) *Counter { return c.with(values) }
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.each(func(labels string, s *Counter) {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, labels, s.Value())
+	})
+}
+
+// Gauge 为可增可减的数值
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Add(n int64)  { g.v.Add(n) }
+func (g *Gauge) Set(n int64)  { g.v.Store(n) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// GaugeVec 为带标签的仪表盘
+type GaugeVec struct{ vec[Gauge] }
+
+// NewGauge 注册一个仪表盘
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[Gauge]{name: name, help: help, typ: "gauge", labels: labels, newT: func() *Gauge { return &Gauge{} }}}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge { return g.with(values) }
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w)
+	g.each(func(labels string, s *Gauge) {
+		fmt.Fprintf(w, "%s%s %d\n", g.name, labels, s.Value())
+	})
+}
+
+// Histogram 按固定分桶统计观测值
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64 // 与 buckets 一一对应，最后一个为 +Inf
+	sum     atomic.Uint64   // float64 的位表示
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.counts[i].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// HistogramVec 为带标签的直方图
+type HistogramVec struct{ vec[Histogram] }
+
+// DefBuckets 适用于以秒为单位的网络延迟
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// NewHistogram 注册一个直方图，buckets 为升序的上界
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec[Histogram]{name: name, help: help, typ: "histogram", labels: labels}}
+	h.newT = func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+	}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram { return h.with(values) }
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.each(func(labels string, s *Histogram) {
+		var cum uint64
+		for i := range s.counts {
+			cum += s.counts[i].Load()
+			le := math.Inf(+1)
+			if i < len(s.buckets) {
+				le = s.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, addLabel(labels, "le", formatFloat(le)), cum)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(math.Float64frombits(s.sum.Load())))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, cum)
+	})
+}
+
+// WriteTo 以文本格式输出所有已注册的指标
+func WriteTo(w io.Writer) {
+	registryMu.Lock()
+	cs := append([]collector(nil), registry...)
+	registryMu.Unlock()
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// Handler 返回 /metrics 的 HTTP 处理函数
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// labelTrackLimit 为 LabelLimiter 在一个统计周期内计数的不同取值个数上限
+const labelTrackLimit = 10000
+
+// LabelLimiter 限制某个标签的取值个数，只保留出现次数最多的 limit 个取值，其余合并为 other，
+// 避免指纹等标签无限增长。Value 累计各取值的次数，Rebuild 定期按次数重新选出前 limit 个，
+// 每次重建后计数减半，使排名跟随近期的流量变化。两次重建之间的新取值在名额未满时直接接纳。
+// 被移出的取值已经导出的序列不会删除，此后的计数归入 other
+type LabelLimiter struct {
+	mu     sync.Mutex
+	top    map[string]struct{}
+	counts map[string]int64
+}
+
+// Value 返回可以用作标签的取值，limit 为允许的不同取值个数
+func (l *LabelLimiter) Value(v string, limit int) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts == nil {
+		l.counts = make(map[string]int64)
+	}
+	if l.top == nil {
+		l.top = make(map[string]struct{})
+	}
+	if _, ok := l.counts[v]; ok || len(l.counts) < labelTrackLimit {
+		l.counts[v]++
+	}
+	if _, ok := l.top[v]; ok {
+		return v
+	}
+	if len(l.top) >= limit {
+		return "other"
+	}
+	l.top[v] = struct{}{}
+	return v
+}
+
+// Rebuild 按累计次数重新选出前 limit 个取值，limit 可以与上次不同
+func (l *LabelLimiter) Rebuild(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := make([]string, 0, len(l.counts))
+	for v := range l.counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if l.counts[values[i]] != l.counts[values[j]] {
+			return l.counts[values[i]] > l.counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if limit < 0 {
+		limit = 0
+	}
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	l.top = make(map[string]struct{}, len(values))
+	for _, v := range values {
+		l.top[v] = struct{}{}
+	}
+	for v, n := range l.counts {
+		if n /= 2; n == 0 {
+			delete(l.counts, v)
+		} else {
+			l.counts[v] = n
+		}
+	}
+}
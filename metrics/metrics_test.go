@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	c := NewCounter("test_requests_total", "请求数", "code")
+	c.With("200").Add(3)
+	c.With(`a"b`).Inc()
+	h := NewHistogram("test_latency_seconds", "延迟", []float64{0.1, 1})
+	h.With().Observe(0.05)
+	h.With().Observe(0.5)
+	h.With().Observe(2)
+
+	var b strings.Builder
+	WriteTo(&b)
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{code="200"} 3` + "\n",
+		`test_requests_total{code="a\"b"} 1` + "\n",
+		`test_latency_seconds_bucket{le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{le="+Inf"} 3` + "\n",
+		"test_latency_seconds_sum 2.55\n",
+		"test_latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLabelLimiter(t *testing.T) {
+	var l LabelLimiter
+	if l.Value("a", 2) != "a" || l.Value("b", 2) != "b" || l.Value("c", 2) != "other" || l.Value("a", 2) != "a" {
+		t.Fatal("超过上限的取值应合并为 other")
+	}
+}
+
+func TestLabelLimiterRebuild(t *testing.T) {
+	var l LabelLimiter
+	l.Value("a", 2)
+	l.Value("b", 2)
+	for i := 0; i < 5; i++ {
+		l.Value("c", 2) // 名额已满，计数但合并为 other
+	}
+	l.Value("b", 2)
+
+	// 重建后按次数保留 c 与 b
+	l.Rebuild(2)
+	if l.Value("c", 2) != "c" || l.Value("b", 2) != "b" || l.Value("a", 2) != "other" {
+		t.Fatal("重建后应保留次数最多的取值")
+	}
+
+	// 调低上限后只保留第一名
+	l.Rebuild(1)
+	if l.Value("c", 1) != "c" || l.Value("b", 1) != "other" {
+		t.Fatal("调低上限后应只保留次数最多的取值")
+	}
+}
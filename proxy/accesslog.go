@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"tls-proxy/config"
+	"tls-proxy/metrics"
+	"unicode/utf8"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 访问日志格式
+const (
+	AccessLogJSON   = "json"
+	AccessLogLogfmt = "logfmt"
+)
+
+// AccessLogOptions 为访问日志的输出文件与轮转参数
+type AccessLogOptions struct {
+	Path       string // 为空时不记录访问日志
+	Format     string // json 或 logfmt
+	MaxSizeMB  int    // 单个文件的大小上限，超过后轮转
+	MaxBackups int    // 保留的旧文件个数，0 表示不限制
+	MaxAgeDays int    // 旧文件的保留天数，0 表示不限制
+	Compress   bool   // 压缩轮转后的旧文件
+}
+
+// accessLogQueue 为等待写入的日志行数上限，写入跟不上时丢弃，避免阻塞 event-loop
+const accessLogQueue = 4096
+
+var (
+	accessLog *accessLogger // 未开启时为 nil
+
+	accessLogDropped = metrics.NewCounter("tlsproxy_accesslog_dropped_total", "写入队列已满而丢弃的访问日志条数").With()
+)
+
+// accessLogger 在单独的 goroutine 中写入访问日志，文件按大小轮转
+type accessLogger struct {
+	format string
+	out    io.Writer
+	lines  chan []byte
+}
+
+func newAccessLogger(opts AccessLogOptions) (*accessLogger, error) {
+	switch opts.Format {
+	case "":
+		opts.Format = AccessLogJSON
+	case AccessLogJSON, AccessLogLogfmt:
+	default:
+		return nil, fmt.Errorf("不支持的访问日志格式: %s", opts.Format)
+	}
+	out := &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    opts.MaxSizeMB,
+		MaxBackups: opts.MaxBackups,
+		MaxAge:     opts.MaxAgeDays,
+		Compress:   opts.Compress,
+		LocalTime:  true,
+	}
+	// lumberjack 在第一次写入时才打开文件，启动时先写入空数据，使路径或权限错误在启动时报告
+	if _, err := out.Write(nil); err != nil {
+		return nil, fmt.Errorf("打开访问日志失败: %w", err)
+	}
+	l := &accessLogger{
+		format: opts.Format,
+		out:    out,
+		lines:  make(chan []byte, accessLogQueue),
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *accessLogger) run() {
+	for line := range l.lines {
+		if _, err := l.out.Write(line); err != nil {
+			slog.Warn("[WARN] 写入访问日志失败", "err", err)
+		}
+	}
+}
+
+func (l *accessLogger) log(fields []logField) {
+	var line []byte
+	if l.format == AccessLogLogfmt {
+		line = encodeLogfmt(fields)
+	} else {
+		line = encodeJSON(fields)
+	}
+	select {
+	case l.lines <- line:
+	default:
+		accessLogDropped.Inc()
+	}
+}
+
+// logField 为一个日志字段，按添加的顺序输出
+type logField struct {
+	key   string
+	value any // string、[]string、bool、int64 或 float64
+}
+
+// accessLogFields 汇总一个连接的访问日志字段
+func (ctx *connContext) accessLogFields(now time.Time) []logField {
+	return []logField{
+		{"time", now.Format(time.RFC3339Nano)},
+		{"client_ip", ctx.clientIP},
+		{"client_port", ctx.clientPort},
+		{"sni", ctx.hello.SNI},
+		{"alpn", ctx.hello.ALPN},
+		{"ech", ctx.hello.ECH},
+		{"ja3", ctx.ja3},
+		{"ja3_raw", ctx.ja3Raw},
+		{"ja3n", ctx.ja3n},
+		{"ja3n_raw", ctx.ja3nRaw},
+		{"ja4", ctx.ja4},
+		{"ja4_r", ctx.ja4Raw},
+		{"rule", ctx.rule},
+		{"decision", ctx.decision},
+		{"upstream", ctx.targetAddr()},
+		{"dial_ms", msec(time.Duration(ctx.dialTime.Load()))},
+		{"bytes_in", ctx.bytesIn.Load()},
+		{"bytes_out", ctx.bytesOut.Load()},
+		{"duration_ms", msec(now.Sub(ctx.openedAt))},
+		{"reason", ctx.getCloseReason()},
+	}
+}
+
+func msec(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// sampled 判断是否记录该连接：阻止、分流与计数的连接以及未完成判定的连接始终记录，
+// 正常转发的连接按 accesslog_sample_rate 采样
+func (ctx *connContext) sampled() bool {
+	if ctx.decision != decisionForward {
+		return true
+	}
+	rate := config.AccessLogSampleRate()
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// writeAccessLog 在连接关闭时输出访问日志
+func (ctx *connContext) writeAccessLog() {
+	if accessLog == nil || !ctx.sampled() {
+		return
+	}
+	accessLog.log(ctx.accessLogFields(time.Now()))
+}
+
+func encodeJSON(fields []logField) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, _ := json.Marshal(f.value)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func encodeLogfmt(fields []logField) []byte {
+	var b bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		var s string
+		switch v := f.value.(type) {
+		case string:
+			s = v
+		case []string:
+			s = strings.Join(v, ",")
+		case bool:
+			s = strconv.FormatBool(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+		b.WriteString(logfmtValue(s))
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// logfmtValue 在取值为空或包含空格、引号、等号及控制字符时加引号
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
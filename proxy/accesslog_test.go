@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccessLogEncoding(t *testing.T) {
+	fields := []logField{
+		{"client_ip", "192.0.2.1"},
+		{"sni", ""},
+		{"alpn", []string{"h2", "http/1.1"}},
+		{"ech", false},
+		{"ja3_raw", "771,4865-4866,0-23,29,0"},
+		{"reason", `say "hi"`},
+		{"bytes_in", int64(517)},
+		{"dial_ms", 1.25},
+	}
+
+	got := string(encodeLogfmt(fields))
+	want := `client_ip=192.0.2.1 sni="" alpn=h2,http/1.1 ech=false ja3_raw=771,4865-4866,0-23,29,0 reason="say \"hi\"" bytes_in=517 dial_ms=1.25` + "\n"
+	if got != want {
+		t.Fatalf("logfmt:\n got %s\nwant %s", got, want)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(encodeJSON(fields), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["client_ip"] != "192.0.2.1" || m["bytes_in"] != 517.0 || len(m["alpn"].([]any)) != 2 {
+		t.Fatalf("json: %v", m)
+	}
+}
+
+func TestNewAccessLoggerOpensFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	if _, err := newAccessLogger(AccessLogOptions{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("访问日志文件应在启动时创建: %v", err)
+	}
+
+	// 父路径是普通文件，无法创建
+	if _, err := newAccessLogger(AccessLogOptions{Path: filepath.Join(path, "access.log")}); err == nil {
+		t.Fatal("无法打开的路径应在启动时返回错误")
+	}
+}
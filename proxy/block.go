@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"tls-proxy/config"
+	"tls-proxy/util"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// blockConn 按配置的响应方式处理被阻止的连接，返回 OnOpen / OnTraffic 应返回的 action。
+// rule 为命中的规则，value 为命中的 IP、指纹或限速键，用于查找条目级别的配置。
+func blockConn(c gnet.Conn, ctx *connContext, rule, value string) gnet.Action {
+	action := config.GetBlockResponse(rule, value)
+	config.IncrStat("block_response:" + action)
+	decisions.With(rule, action).Inc()
+	ctx.rule, ctx.decision = rule, action
+	event := config.EventBlock
+	if rule == config.RuleRateLimit {
+		event = config.EventRateLimit
+	}
+	reportEvent(c, ctx, event, action, value, ctx.origDst)
+	switch action {
+	case config.BlockRST:
+		c.SetLinger(0)
+	case config.BlockAlertHandshakeFailure:
+		c.Write(util.TLSAlert(util.AlertHandshakeFailure))
+	case config.BlockAlertAccessDenied:
+		c.Write(util.TLSAlert(util.AlertAccessDenied))
+	case config.BlockAlertUnrecognizedName:
+		c.Write(util.TLSAlert(util.AlertUnrecognizedName))
+	case config.BlockTarpit:
+		if startTarpit(c, ctx) {
+			return gnet.None
+		}
+	}
+	return gnet.Close
+}
+
+// reportEvent 把连接事件连同连接的元数据写入事件流，rule 取自 ctx
+func reportEvent(c gnet.Conn, ctx *connContext, event, action, value, target string) {
+	config.ReportEvent(config.Event{
+		Type:       event,
+		Rule:       ctx.rule,
+		Action:     action,
+		Value:      value,
+		ClientIP:   ctx.clientIP,
+		ClientPort: ctx.clientPort,
+		Listener:   listenerName(c),
+		SNI:        ctx.hello.SNI,
+		ALPN:       ctx.hello.ALPN,
+		ECH:        ctx.hello.ECH,
+		JA3:        ctx.ja3,
+		JA3N:       ctx.ja3n,
+		JA4:        ctx.ja4,
+		Target:     target,
+	})
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"syscall"
+	"time"
+)
+
+// 连接关闭原因，记录在 connContext 上并输出到关闭日志
+const (
+	reasonClientFIN           = "client_fin"     // 客户端先发送 FIN，双向数据均已转发完毕
+	reasonUpstreamFIN         = "upstream_fin"   // 上游先发送 FIN，双向数据均已转发完毕
+	reasonClientReset         = "client_rst"     // 客户端发送 RST
+	reasonUpstreamReset       = "upstream_rst"   // 上游发送 RST
+	reasonClientError         = "client_error"   // 客户端连接读写出错
+	reasonUpstreamError       = "upstream_error" // 上游连接读写出错
+	reasonDialFailed          = "dial_failed"
+	reasonHandshakeTimeout    = "handshake_timeout"
+	reasonClientHelloTimeout  = "clienthello_timeout"
+	reasonIdleTimeout         = "idle_timeout"
+	reasonPreBufferLimit      = "prebuffer_limit"
+	reasonClientHelloTooLarge = "clienthello_too_large"
+	reasonRelayOverflow       = "relay_overflow"
+	reasonConnLimit           = "connlimit"
+	reasonRateLimited         = "ratelimited"
+	reasonBlocked             = "blocked"
+	reasonOriginalDst         = "orig_dst"       // 透明代理无法获取原始目标地址
+	reasonTunnelRequest       = "tunnel_request" // 正向代理握手无效
+	reasonPreamble            = "preamble"       // STARTTLS 之前的明文交互未完成
+	reasonClosed              = "closed"         // 未记录具体原因的主动关闭
+)
+
+const (
+	sideClient   = "client"
+	sideUpstream = "upstream"
+)
+
+// classifyClose 按读写错误归类关闭原因，reset 表示应向另一端传递 RST
+func classifyClose(side string, err error) (reason string, reset bool) {
+	switch {
+	case err == nil:
+		return reasonClosed, false
+	case errors.Is(err, io.EOF):
+		if side == sideClient {
+			return reasonClientFIN, false
+		}
+		return reasonUpstreamFIN, false
+	case errors.Is(err, syscall.ECONNRESET):
+		if side == sideClient {
+			return reasonClientReset, true
+		}
+		return reasonUpstreamReset, true
+	default:
+		// 其他错误同样中止连接，避免对端把不完整的数据当作正常结束
+		if side == sideClient {
+			return reasonClientError, true
+		}
+		return reasonUpstreamError, true
+	}
+}
+
+// setCloseReason 记录关闭原因，只保留第一次记录的原因
+func (ctx *connContext) setCloseReason(reason string) {
+	ctx.closeReason.CompareAndSwap(nil, reason)
+}
+
+func (ctx *connContext) getCloseReason() string {
+	if reason, ok := ctx.closeReason.Load().(string); ok {
+		return reason
+	}
+	return reasonClosed
+}
+
+// logClose 输出连接关闭日志与访问日志，已建立转发的连接使用 Info 级别
+func (ctx *connContext) logClose() {
+	ctx.writeAccessLog()
+	level := slog.LevelDebug
+	if ctx.handshakeDone.Load() {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "[CLOSE] 连接关闭", "ip", ctx.clientIP, "target", ctx.targetAddr(),
+		"reason", ctx.getCloseReason(), "duration", time.Since(ctx.openedAt).Round(time.Millisecond))
+}
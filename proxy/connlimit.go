@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// connCounter 统计某一维度下的并发连接数，多个 event-loop 共享
+type connCounter struct {
+	mu sync.Mutex
+	m  map[string]int64
+}
+
+func newConnCounter() *connCounter {
+	return &connCounter{m: make(map[string]int64)}
+}
+
+// acquire 在未超过上限时计数加一，limit <= 0 表示不限制
+func (cc *connCounter) acquire(key string, limit int64) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if limit > 0 && cc.m[key] >= limit {
+		return false
+	}
+	cc.m[key]++
+	return true
+}
+
+func (cc *connCounter) release(key string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.m[key] <= 1 {
+		delete(cc.m, key)
+		return
+	}
+	cc.m[key]--
+}
+
+var (
+	ipConns     = newConnCounter()
+	prefixConns = newConnCounter()
+	fpConns     = newConnCounter()
+)
+
+// ipPrefix 返回客户端 IP 所在网段，例如 1.2.3.0/24、2001:db8::/64
+func ipPrefix(ip string, bitsV4, bitsV6 int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := bitsV6
+	if addr.Is4() {
+		bits = bitsV4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
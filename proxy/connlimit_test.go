@@ -0,0 +1,63 @@
+package proxy
+
+import "testing"
+
+func TestConnCounter(t *testing.T) {
+	cc := newConnCounter()
+	for i := 0; i < 2; i++ {
+		if !cc.acquire("a", 2) {
+			t.Fatalf("acquire %d should succeed", i+1)
+		}
+	}
+	if cc.acquire("a", 2) {
+		t.Error("acquire past the limit should fail")
+	}
+	if !cc.acquire("b", 2) || !cc.acquire("a", 0) {
+		t.Error("other keys and unlimited acquires should succeed")
+	}
+
+	cc.release("a")
+	if !cc.acquire("a", 4) {
+		t.Error("acquire after release should succeed")
+	}
+	for i := 0; i < 4; i++ {
+		cc.release("a")
+	}
+	cc.release("b")
+	if len(cc.m) != 0 {
+		t.Errorf("counters should be removed once released, got %v", cc.m)
+	}
+}
+
+func TestReleaseConnLimits(t *testing.T) {
+	ctx := &connContext{ipConnKey: "192.0.2.99", prefixConnKey: "192.0.2.0/24", fpConnKey: "t13d_test"}
+	ipConns.acquire(ctx.ipConnKey, 1)
+	prefixConns.acquire(ctx.prefixConnKey, 1)
+	fpConns.acquire(ctx.fpConnKey, 1)
+
+	ctx.releaseConnLimits()
+	if !ipConns.acquire(ctx.ipConnKey, 1) || !prefixConns.acquire(ctx.prefixConnKey, 1) || !fpConns.acquire(ctx.fpConnKey, 1) {
+		t.Error("closing the connection should release every counter")
+	}
+	ctx.releaseConnLimits()
+}
+
+func TestIPPrefix(t *testing.T) {
+	tests := []struct {
+		ip     string
+		v4, v6 int
+		want   string
+	}{
+		{"192.0.2.1", 24, 64, "192.0.2.0/24"},
+		{"192.0.2.1", 32, 64, "192.0.2.1/32"},
+		{"::ffff:192.0.2.1", 24, 64, "192.0.2.0/24"},
+		{"2001:db8:1:2:3:4:5:6", 24, 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:3:4:5:6", 24, 48, "2001:db8:1::/48"},
+		{"not-an-ip", 24, 64, "not-an-ip"},
+	}
+	for _, tt := range tests {
+		if got := ipPrefix(tt.ip, tt.v4, tt.v6); got != tt.want {
+			t.Errorf("ipPrefix(%q, %d, %d) = %q, want %q", tt.ip, tt.v4, tt.v6, got, tt.want)
+		}
+	}
+}
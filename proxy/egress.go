@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"tls-proxy/config"
+)
+
+// 正向代理握手的回复
+var (
+	socksNoAuth          = []byte{0x05, 0x00}
+	socksNoAcceptable    = []byte{0x05, 0xFF}
+	socksSucceeded       = []byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+	socksCmdNotSupported = []byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+	socksAddrNotSupport  = []byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+	socksNotAllowed      = []byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+
+	httpEstablished      = []byte("HTTP/1.1 200 Connection Established\r\n\r\n")
+	httpMethodNotAllowed = []byte("HTTP/1.1 405 Method Not Allowed\r\nConnection: close\r\n\r\n")
+	httpBadRequest       = []byte("HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+	httpForbidden        = []byte("HTTP/1.1 403 Forbidden\r\nConnection: close\r\n\r\n")
+)
+
+var (
+	errTunnelRequest = errors.New("无效的正向代理请求")
+	errEgressDenied  = errors.New("出站目标不在允许范围内")
+)
+
+// parseTunnel 解析正向代理监听器上的握手，支持 HTTP CONNECT 与 SOCKS5（无认证、CONNECT 命令）。
+// 返回已消费的字节数、应回复给客户端的数据与隧道目标地址；数据不完整时 n 为 0。
+// SOCKS5 分两步：greeted 为 false 时解析方法协商，完成后 target 为空，调用方记录后继续解析连接请求。
+// 成功回复在连接上游之前发送：上游要等 ClientHello 判定通过后才连接，连接失败时直接关闭隧道
+func parseTunnel(buf []byte, greeted bool) (n int, reply []byte, target string, err error) {
+	if len(buf) == 0 {
+		return 0, nil, "", nil
+	}
+	if buf[0] == 0x05 {
+		if !greeted {
+			return parseSocksGreeting(buf)
+		}
+		return parseSocksRequest(buf)
+	}
+	return parseHTTPConnect(buf)
+}
+
+func parseSocksGreeting(buf []byte) (int, []byte, string, error) {
+	if len(buf) < 2 || len(buf) < 2+int(buf[1]) {
+		return 0, nil, "", nil
+	}
+	n := 2 + int(buf[1])
+	if bytes.IndexByte(buf[2:n], 0x00) < 0 {
+		return n, socksNoAcceptable, "", errTunnelRequest
+	}
+	return n, socksNoAuth, "", nil
+}
+
+func parseSocksRequest(buf []byte) (int, []byte, string, error) {
+	if len(buf) < 5 {
+		return 0, nil, "", nil
+	}
+	if buf[1] != 0x01 {
+		return len(buf), socksCmdNotSupported, "", errTunnelRequest
+	}
+	var host string
+	off := 4
+	switch buf[3] {
+	case 0x01:
+		if len(buf) < off+4+2 {
+			return 0, nil, "", nil
+		}
+		host = net.IP(buf[off : off+4]).String()
+		off += 4
+	case 0x03:
+		l := int(buf[off])
+		if len(buf) < off+1+l+2 {
+			return 0, nil, "", nil
+		}
+		host = string(buf[off+1 : off+1+l])
+		off += 1 + l
+	case 0x04:
+		if len(buf) < off+16+2 {
+			return 0, nil, "", nil
+		}
+		host = net.IP(buf[off : off+16]).String()
+		off += 16
+	default:
+		return len(buf), socksAddrNotSupport, "", errTunnelRequest
+	}
+	port := int(buf[off])<<8 | int(buf[off+1])
+	return off + 2, socksSucceeded, net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func parseHTTPConnect(buf []byte) (int, []byte, string, error) {
+	end := bytes.Index(buf, []byte("\r\n\r\n"))
+	if end < 0 {
+		return 0, nil, "", nil
+	}
+	n := end + 4
+	line, _, _ := strings.Cut(string(buf[:end]), "\r\n")
+	fields := strings.Fields(line)
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") {
+		return n, httpBadRequest, "", errTunnelRequest
+	}
+	if fields[0] != "CONNECT" {
+		return n, httpMethodNotAllowed, "", errTunnelRequest
+	}
+	if _, port, err := net.SplitHostPort(fields[1]); err != nil || port == "" {
+		return n, httpBadRequest, "", errTunnelRequest
+	}
+	return n, httpEstablished, fields[1], nil
+}
+
+// checkTunnelTarget 按出站目标策略检查隧道目标，buf 为握手请求，用于选择拒绝时的回复。
+// 目标为域名时只检查端口，地址在连接时由 egressControl 检查
+func checkTunnelTarget(buf []byte, target string) ([]byte, error) {
+	reply := httpForbidden
+	if len(buf) > 0 && buf[0] == 0x05 {
+		reply = socksNotAllowed
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return reply, err
+	}
+	if !config.EgressPortAllowed(port) {
+		return reply, errEgressDenied
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !config.EgressAddrAllowed(addr) {
+		return reply, errEgressDenied
+	}
+	return nil, nil
+}
+
+// egressControl 用于 net.Dialer，在建立连接前检查域名解析出的目标地址，避免 DNS 指向内网绕过出站策略
+func egressControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !config.EgressAddrAllowed(ap.Addr()) {
+		return errEgressDenied
+	}
+	return nil
+}
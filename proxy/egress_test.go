@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseTunnel(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		greeted bool
+		n       int
+		reply   []byte
+		target  string
+		wantErr bool
+	}{
+		{"http 不完整", []byte("CONNECT example.com:443 HTTP/1.1\r\n"), false, 0, nil, "", false},
+		{"http connect", []byte("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com\r\n\r\n\x16"), false, 55, httpEstablished, "example.com:443", false},
+		{"http get", []byte("GET / HTTP/1.1\r\n\r\n"), false, 18, httpMethodNotAllowed, "", true},
+		{"http 缺少端口", []byte("CONNECT example.com HTTP/1.1\r\n\r\n"), false, 32, httpBadRequest, "", true},
+		{"socks 协商", []byte{5, 2, 2, 0}, false, 4, socksNoAuth, "", false},
+		{"socks 仅支持认证", []byte{5, 1, 2}, false, 3, socksNoAcceptable, "", true},
+		{"socks ipv4", []byte{5, 1, 0, 1, 10, 0, 0, 1, 1, 187, 0x16}, true, 10, socksSucceeded, "10.0.0.1:443", false},
+		{"socks 域名", append(append([]byte{5, 1, 0, 3, 11}, "example.com"...), 0, 80), true, 18, socksSucceeded, "example.com:80", false},
+		{"socks 域名不完整", []byte{5, 1, 0, 3, 11, 'e'}, true, 0, nil, "", false},
+		{"socks bind", []byte{5, 2, 0, 1, 10, 0, 0, 1, 1, 187}, true, 10, socksCmdNotSupported, "", true},
+	}
+	for _, tt := range tests {
+		n, reply, target, err := parseTunnel(tt.buf, tt.greeted)
+		if n != tt.n || !bytes.Equal(reply, tt.reply) || target != tt.target || (err != nil) != tt.wantErr {
+			t.Errorf("%s: got n=%d reply=%q target=%q err=%v", tt.name, n, reply, target, err)
+		}
+	}
+}
+
+func TestCheckTunnelTarget(t *testing.T) {
+	httpReq := []byte("CONNECT x HTTP/1.1\r\n\r\n")
+	socksReq := []byte{5, 1, 0, 1}
+	tests := []struct {
+		name   string
+		buf    []byte
+		target string
+		reply  []byte
+	}{
+		{"公网地址", httpReq, "203.0.113.7:443", nil},
+		{"域名", socksReq, "example.com:443", nil},
+		{"端口不允许", httpReq, "example.com:22", httpForbidden},
+		{"私有地址", socksReq, "10.0.0.1:443", socksNotAllowed},
+		{"回环地址", httpReq, "127.0.0.1:443", httpForbidden},
+		{"云元数据", httpReq, "169.254.169.254:443", httpForbidden},
+		{"IPv6 ULA", socksReq, "[fd00::1]:443", socksNotAllowed},
+		{"IPv4 映射的回环地址", httpReq, "[::ffff:127.0.0.1]:443", httpForbidden},
+	}
+	for _, tt := range tests {
+		reply, err := checkTunnelTarget(tt.buf, tt.target)
+		if !bytes.Equal(reply, tt.reply) || (err != nil) != (tt.reply != nil) {
+			t.Errorf("%s: got reply=%q err=%v", tt.name, reply, err)
+		}
+	}
+
+	if err := egressControl("tcp4", "10.1.2.3:443", nil); err != errEgressDenied {
+		t.Errorf("egressControl(10.1.2.3) = %v, want errEgressDenied", err)
+	}
+	if err := egressControl("tcp4", "203.0.113.7:443", nil); err != nil {
+		t.Errorf("egressControl(203.0.113.7) = %v", err)
+	}
+}
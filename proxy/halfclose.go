@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// gnet 读到 EOF 后会直接关闭整个连接，无法保留写方向。为支持半关闭，在 OnClose 中复制 fd，
+// 由 halfWriter 在独立 goroutine 中把另一端的剩余数据写完，再正常关闭。
+
+// halfWriter 向已发送 FIN 的一端继续写入数据
+type halfWriter struct {
+	r    *relay
+	conn *net.TCPConn
+	side string
+	f    *flow // 写往该端方向的流量控制
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []halfWrite
+	eof    bool // 另一端也已结束，写完后关闭
+	closed bool
+}
+
+type halfWrite struct {
+	buf []byte
+	src gnet.Conn // 数据来源，写出后据此恢复读取
+}
+
+func newHalfWriter(r *relay, conn *net.TCPConn, side string, f *flow) *halfWriter {
+	h := &halfWriter{r: r, conn: conn, side: side, f: f}
+	h.cond = sync.NewCond(&h.mu)
+	go h.run()
+	return h
+}
+
+// write 追加待写数据，数据量已计入 f.queued，写出后扣减
+func (h *halfWriter) write(buf []byte, src gnet.Conn) {
+	h.mu.Lock()
+	h.queue = append(h.queue, halfWrite{buf: buf, src: src})
+	h.mu.Unlock()
+	h.cond.Signal()
+}
+
+// finish 另一端已结束，写完剩余数据后关闭连接
+func (h *halfWriter) finish() {
+	h.mu.Lock()
+	h.eof = true
+	h.mu.Unlock()
+	h.cond.Signal()
+}
+
+// close 立即关闭，reset 为 true 时向该端发送 RST
+func (h *halfWriter) close(reset bool) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	h.mu.Unlock()
+	h.cond.Signal()
+	if reset {
+		h.conn.SetLinger(0)
+	}
+	h.conn.Close()
+}
+
+func (h *halfWriter) run() {
+	for {
+		h.mu.Lock()
+		for len(h.queue) == 0 && !h.eof && !h.closed {
+			h.cond.Wait()
+		}
+		queue, eof, closed := h.queue, h.eof, h.closed
+		h.queue = nil
+		h.mu.Unlock()
+
+		if closed {
+			return
+		}
+		for _, w := range queue {
+			n := int64(len(w.buf))
+			_, err := h.conn.Write(w.buf)
+			h.f.queued.Add(-n)
+			if err != nil {
+				reason, _ := classifyClose(h.side, err)
+				h.r.teardown(reason, true)
+				return
+			}
+			h.r.ctx.touch()
+			h.r.maybeResume(w.src, h.f)
+		}
+		if eof && len(queue) == 0 {
+			// 两个方向都已结束
+			h.r.teardown(h.r.finReason(), false)
+			return
+		}
+	}
+}
+
+// closeConn 关闭 gnet 连接，reset 为 true 时发送 RST
+func closeConn(c gnet.Conn, reset bool) {
+	if !reset {
+		c.Close()
+		return
+	}
+	c.Wake(func(dc gnet.Conn, _ error) error {
+		// 已关闭连接的 Context 被 gnet 置为 nil，其 fd 可能已被复用，不能再设置
+		if dc.Context() != nil {
+			dc.SetLinger(0)
+		}
+		return dc.Close()
+	})
+}
+
+// closeWrite 在 dst 所属 event-loop 中等待 outbound 缓冲写完后关闭写方向，向 dst 发送 FIN
+func (r *relay) closeWrite(dst gnet.Conn) {
+	dst.Wake(func(dc gnet.Conn, _ error) error {
+		if dc.Context() == nil || r.ctx.closed.Load() {
+			return nil
+		}
+		if dc.OutboundBuffered() > 0 {
+			relayWheel.AfterFunc(relayWheel.interval, func() { r.closeWrite(dst) })
+			return nil
+		}
+		if err := shutdownWrite(dc.Fd()); err != nil {
+			return dc.Close()
+		}
+		return nil
+	})
+}
+
+// sendEOF 在 dst 的写队列末尾放入结束标记：dst 仍打开时关闭其写方向；
+// dst 已半关闭时由其 halfWriter 写完剩余数据后关闭
+func (r *relay) sendEOF(dst gnet.Conn) {
+	err := dst.AsyncWrite(nil, func(dc gnet.Conn, err error) error {
+		if err != nil {
+			if h := r.halfOf(dst); h != nil {
+				h.finish()
+			}
+			return nil
+		}
+		r.closeWrite(dc)
+		return nil
+	})
+	if err != nil {
+		r.teardown(reasonClosed, false)
+	}
+}
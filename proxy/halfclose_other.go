@@ -0,0 +1,22 @@
+//go:build !unix
+
+package proxy
+
+import (
+	"errors"
+	"net"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var errHalfCloseUnsupported = errors.New("半关闭仅支持类 Unix 系统")
+
+// dupConn 不支持时返回错误，调用方按整条连接关闭处理
+func dupConn(_ gnet.Conn) (*net.TCPConn, error) {
+	return nil, errHalfCloseUnsupported
+}
+
+// shutdownWrite 不支持时返回错误，调用方直接关闭连接
+func shutdownWrite(_ int) error {
+	return errHalfCloseUnsupported
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package proxy
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// dupConn 复制 gnet 连接的 fd 并转换为 *net.TCPConn，gnet 关闭原 fd 后连接仍然有效。
+// 只能在连接所属的 event-loop 中调用。
+func dupConn(c gnet.Conn) (*net.TCPConn, error) {
+	fd, err := syscall.Dup(c.Fd())
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "")
+	nc, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	tc, ok := nc.(*net.TCPConn)
+	if !ok {
+		nc.Close()
+		return nil, syscall.EINVAL
+	}
+	return tc, nil
+}
+
+// shutdownWrite 关闭 fd 的写方向，向对端发送 FIN
+func shutdownWrite(fd int) error {
+	return syscall.Shutdown(fd, syscall.SHUT_WR)
+}
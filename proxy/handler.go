@@ -2,10 +2,11 @@
 package proxy
 
 import (
-	"io"
+	"fmt"
 	"log/slog"
 	"net"
-	"strings"
+	"runtime"
+	"sync/atomic"
 	"time"
 	"tls-proxy/config"
 	"tls-proxy/fingerprint"
@@ -16,102 +17,570 @@ import (
 
 type proxyServer struct {
 	gnet.BuiltinEventEngine
-	forwardAddr string
+	pool     *upstreamPool
+	upstream *upstreamEngine
+	opts     Options
+
+	egressPorts   map[string]bool   // 正向代理监听器
+	starttlsPorts map[string]string // STARTTLS 监听器及其协议
+
+	// 透明代理用于识别指向自身的连接
+	listenPorts map[string]bool
+	localIPs    map[string]bool
 }
 
 type connContext struct {
-	handshakeDone bool
+	handshakeDone atomic.Bool
+	closed        atomic.Bool
+	bypass        bool // 命中 IP 白名单，跳过所有检查
+	spliced       bool // 已移出 event-loop 改用 splice 转发
+	egress        bool // 正向代理连接，首包之前先完成隧道握手
+	socksGreeted  bool // SOCKS5 方法协商已完成
+	starttls      *startTLS
+	tarpit        bool // 处于 tarpit 中，丢弃客户端数据
+	clientIP      string
+	clientPort    string
 	clientBuffer  []byte
-	targetConn    net.Conn
+	openedAt      time.Time
+	firstByteAt   time.Time
+	origDst       string       // 透明代理的原始目标地址或正向代理的隧道目标
+	target        atomic.Value // string，实际连接的上游地址
+	member        atomic.Pointer[poolMember]
+	relay         *relay
+	ja3           string
+	ja3n          string
+	ja4           string
+	hello         util.ClientHelloInfo // SNI、ALPN 与 ECH 扩展
+
+	// 访问日志使用的字段，原始指纹只在开启访问日志时记录
+	ja3Raw   string
+	ja3nRaw  string
+	ja4Raw   string
+	rule     string       // 命中的规则，未命中时为 none
+	decision string       // 处理结果，见 decisionForward 等，被阻止时为响应方式
+	dialTime atomic.Int64 // 连接上游的总耗时（纳秒），包含重试
+
+	// 已计入并发连接数的键，关闭时释放
+	ipConnKey     string
+	prefixConnKey string
+	fpConnKey     string
+
+	// 超时控制，定时器回调在时间轮 goroutine 中执行
+	handshakeTimer   *wheelTimer
+	clientHelloTimer *wheelTimer
+	idleTimer        atomic.Pointer[wheelTimer]
+	lastActive       atomic.Int64
+
+	closeReason atomic.Value // string，见 closereason.go
+
+	// 已转发的字节数：客户端到上游、上游到客户端
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
 }
 
-func (ps *proxyServer) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
-	c.SetContext(&connContext{})
+// remoteAddr 返回客户端 IP（兼容 IPv6）与端口
+func remoteAddr(c gnet.Conn) (string, string) {
+	host, port, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil {
+		return c.RemoteAddr().String(), ""
+	}
+	return host, port
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (ps *proxyServer) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
+	clientIP, clientPort := remoteAddr(c)
+	ctx := &connContext{clientIP: clientIP, clientPort: clientPort, openedAt: time.Now()}
+	c.SetContext(ctx)
+	connAccepted.With(listenerName(c)).Inc()
+	if config.ShouldBlockIP(clientIP) {
+		slog.Info("[BLOCK] IP", "ip", clientIP, "remaining", config.TempBlockRemaining(config.KindIP, clientIP).Round(time.Second))
+		ctx.setCloseReason(reasonBlocked)
+		return nil, blockConn(c, ctx, config.KindIP, clientIP)
+	}
+	if ps.egressPorts[listenerName(c)] {
+		ctx.egress = true
+	} else if ps.opts.Transparent {
+		dst, err := ps.resolveOriginalDst(c)
+		if err != nil {
+			slog.Warn("[WARN] 透明代理无法获取原始目标地址", "ip", clientIP, "local", c.LocalAddr().String(), "err", err)
+			ctx.setCloseReason(reasonOriginalDst)
+			return nil, gnet.Close
+		}
+		ctx.origDst = dst
+	}
+	if proto := ps.starttlsPorts[listenerName(c)]; proto != "" {
+		ctx.starttls = newStartTLS(proto)
+		out = ctx.starttls.greeting()
+	}
+	armHandshakeDeadline(c, ctx)
+
+	if config.IsIPWhitelisted(clientIP) {
+		ctx.bypass = true
+		return
+	}
+
+	limits := config.GetConnLimits()
+	if !ipConns.acquire(clientIP, limits.PerIP) {
+		slog.Info("[CONNLIMIT] IP", "ip", clientIP, "limit", limits.PerIP)
+		ctx.setCloseReason(reasonConnLimit)
+		return nil, blockConn(c, ctx, config.RuleConnLimit, clientIP)
+	}
+	ctx.ipConnKey = clientIP
+	prefix := ipPrefix(clientIP, limits.PrefixV4, limits.PrefixV6)
+	if !prefixConns.acquire(prefix, limits.PerPrefix) {
+		slog.Info("[CONNLIMIT] 网段", "prefix", prefix, "ip", clientIP, "limit", limits.PerPrefix)
+		ctx.setCloseReason(reasonConnLimit)
+		return nil, blockConn(c, ctx, config.RuleConnLimit, prefix)
+	}
+	ctx.prefixConnKey = prefix
 	return
 }
 
-func (ps *proxyServer) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
-	ctx := c.Context().(*connContext)
-	if ctx.targetConn != nil {
-		ctx.targetConn.Close()
+func (ps *proxyServer) OnClose(c gnet.Conn, err error) (action gnet.Action) {
+	ctx, ok := c.Context().(*connContext)
+	if !ok || ctx.spliced {
+		// splice 转发结束时由 finishSplice 释放资源
+		return
+	}
+	if ctx.relay != nil {
+		ctx.relay.onClose(c, err)
+		return
 	}
+	if err != nil {
+		reason, _ := classifyClose(sideClient, err)
+		ctx.setCloseReason(reason)
+	}
+	ctx.closed.Store(true)
+	ctx.stopTimers()
+	stopTarpit(ctx)
+	ctx.releaseConnLimits()
+	ctx.logClose()
 	return
 }
 
+// releaseConnLimits 释放已计入的并发连接数
+func (ctx *connContext) releaseConnLimits() {
+	if ctx.ipConnKey != "" {
+		ipConns.release(ctx.ipConnKey)
+	}
+	if ctx.prefixConnKey != "" {
+		prefixConns.release(ctx.prefixConnKey)
+	}
+	if ctx.fpConnKey != "" {
+		fpConns.release(ctx.fpConnKey)
+	}
+}
+
+// finishSplice splice 转发结束后释放资源
+func (ctx *connContext) finishSplice() {
+	activeRelays.With(relayModeSplice).Add(-1)
+	ctx.closed.Store(true)
+	ctx.stopTimers()
+	ctx.releaseConnLimits()
+	ctx.releaseUpstream()
+	ctx.logClose()
+}
+
 func (ps *proxyServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 	ctx := c.Context().(*connContext)
+	if ctx.handshakeDone.Load() {
+		return ctx.relay.onClientTraffic(c)
+	}
+	if ctx.tarpit {
+		c.Discard(-1)
+		return
+	}
+
 	data, _ := c.Next(-1)
+	if ctx.firstByteAt.IsZero() && !ctx.egress && ctx.starttls == nil {
+		armClientHelloDeadline(c, ctx)
+	}
+	ctx.clientBuffer = append(ctx.clientBuffer, data...)
+	if len(ctx.clientBuffer) > config.PreHandshakeMaxBytes() {
+		config.IncrStat("limit:prebuffer")
+		slog.Info("[BLOCK] 首包判定前缓存超过上限", "ip", ctx.clientIP, "size", len(ctx.clientBuffer))
+		ctx.setCloseReason(reasonPreBufferLimit)
+		return gnet.Close
+	}
+	for ctx.egress && ctx.origDst == "" {
+		n, reply, target, err := parseTunnel(ctx.clientBuffer, ctx.socksGreeted)
+		if err == nil && target != "" {
+			if denied, derr := checkTunnelTarget(ctx.clientBuffer, target); derr != nil {
+				config.IncrStat("egress:denied")
+				slog.Info("[BLOCK] 出站目标不允许", "ip", ctx.clientIP, "target", target, "err", derr)
+				reply, err = denied, derr
+			}
+		}
+		if reply != nil {
+			c.Write(reply)
+		}
+		if err != nil {
+			slog.Debug("正向代理握手无效", "ip", ctx.clientIP, "err", err)
+			ctx.setCloseReason(reasonTunnelRequest)
+			return gnet.Close
+		}
+		if n == 0 {
+			return
+		}
+		ctx.clientBuffer = ctx.clientBuffer[n:]
+		if target == "" {
+			ctx.socksGreeted = true
+			continue
+		}
+		// ClientHello 接收超时从隧道建立后开始计算
+		ctx.origDst = target
+		armClientHelloDeadline(c, ctx)
+	}
+	for ctx.starttls != nil && !ctx.starttls.ready {
+		n, reply, err := ctx.starttls.handle(ctx.clientBuffer)
+		if reply != nil {
+			c.Write(reply)
+		}
+		if err != nil {
+			slog.Debug("STARTTLS 明文交互结束", "ip", ctx.clientIP, "proto", ctx.starttls.proto, "err", err)
+			ctx.setCloseReason(reasonPreamble)
+			return gnet.Close
+		}
+		if n == 0 && !ctx.starttls.ready {
+			return
+		}
+		ctx.clientBuffer = ctx.clientBuffer[n:]
+		if ctx.starttls.ready {
+			armClientHelloDeadline(c, ctx)
+		}
+	}
+	if len(ctx.clientBuffer) < 5 {
+		return
+	}
+	clientData := ctx.clientBuffer
+	clientIP := ctx.clientIP
 
-	if !ctx.handshakeDone {
-		ctx.clientBuffer = append(ctx.clientBuffer, data...)
-		if len(ctx.clientBuffer) < 5 {
+	// 等待完整的 ClientHello，防止拆分发送绕过指纹检查
+	var (
+		hello []byte
+		class string // 无法提取指纹时的首包分类
+	)
+	switch {
+	case ctx.bypass:
+	case util.IsSSLv2ClientHello(clientData):
+		class = config.FlightSSLv2
+	case !util.IsTLSClientHello(clientData):
+		class = config.FlightNonTLS
+	default:
+		record, complete, err := util.ReassembleClientHello(clientData, config.ClientHelloMaxBytes())
+		switch {
+		case err == util.ErrClientHelloTooLarge:
+			config.IncrStat("limit:clienthello_size")
+			clientHellos.With("too_large").Inc()
+			slog.Info("[BLOCK] ClientHello 超过长度上限", "ip", clientIP, "size", len(clientData))
+			ctx.setCloseReason(reasonClientHelloTooLarge)
+			return gnet.Close
+		case err != nil:
+			slog.Debug("ClientHello 解析失败", "ip", clientIP, "err", err)
+			class = config.FlightMalformed
+		case !complete:
+			// 超时为 0 表示不限制，与 armClientHelloDeadline 一致
+			if d := config.ClientHelloTimeout(); d > 0 && time.Since(ctx.firstByteAt) > d {
+				config.IncrStat("timeout:clienthello")
+				clientHellos.With("timeout").Inc()
+				slog.Info("[BLOCK] ClientHello 接收超时", "ip", clientIP, "size", len(clientData))
+				ctx.setCloseReason(reasonClientHelloTimeout)
+				return gnet.Close
+			}
 			return
+		default:
+			hello = record
 		}
-		clientData := ctx.clientBuffer
-		clientIP := strings.Split(c.RemoteAddr().String(), ":")[0]
-
-		if util.IsTLSClientHello(clientData) {
-			if config.EnableJA3Check() || config.EnableJA3Collection() || config.EnableJA3NCheck() || config.EnableJA3NCollection() {
-				ja3Str, ja3nStr, err := fingerprint.JA3Fingerprint(&clientData)
-				if err == nil {
-					if config.EnableJA3Collection() {
-						go config.ReportJA3(ja3Str)
-					}
-					if config.EnableJA3Check() && config.ShouldBlockJA3(ja3Str) {
-						go config.ReportJA3BlockedEvent(ja3Str)
-						slog.Info("[BLOCK] JA3", "ja3", ja3Str, "ip", clientIP)
-						return gnet.Close
-					}
-					if config.EnableJA3NCollection() {
-						go config.ReportJA3N(ja3nStr)
-					}
-					if config.EnableJA3NCheck() && config.ShouldBlockJA3N(ja3nStr) {
-						go config.ReportJA3NBlockedEvent(ja3nStr)
-						slog.Info("[BLOCK] JA3N", "ja3n", ja3nStr, "ip", clientIP)
-						return gnet.Close
-					}
+	}
+
+	if hello != nil {
+		if info, err := util.ParseClientHello(hello); err == nil {
+			ctx.hello = info
+		}
+		sample := config.ClientSample{IP: clientIP, SNI: ctx.hello.SNI, ClientHello: hello}
+		parseFailed := false
+		if config.EnableJA3Check() || config.EnableJA3Collection() || config.EnableJA3NCheck() || config.EnableJA3NCollection() || config.HasTempBlocks(config.KindJA3) || config.HasTempBlocks(config.KindJA3N) || config.RateLimitUses(config.KindJA3N) || config.LBHashUses(config.KindJA3N) || ctx.egress || accessLog != nil {
+			ja3Str, ja3nStr, ja3Raw, ja3nRaw, err := fingerprint.JA3FingerprintRaw(&hello)
+			if err != nil {
+				parseFailed = true
+			} else {
+				ctx.ja3, ctx.ja3n = ja3Str, ja3nStr
+				if accessLog != nil {
+					ctx.ja3Raw, ctx.ja3nRaw = ja3Raw, ja3nRaw
+				}
+				countFingerprint(config.KindJA3, ja3Str)
+				countFingerprint(config.KindJA3N, ja3nStr)
+				if ctx.egress {
+					go config.ReportEgress(config.KindJA3, clientIP, ja3Str)
+					go config.ReportEgress(config.KindJA3N, clientIP, ja3nStr)
+				}
+				if config.EnableJA3Collection() {
+					go config.ReportJA3(ja3Str, sample)
+				}
+				if config.ShouldBlockJA3(ja3Str) {
+					go config.ReportJA3BlockedEvent(ja3Str)
+					slog.Info("[BLOCK] JA3", "ja3", ja3Str, "ip", clientIP, "remaining", config.TempBlockRemaining(config.KindJA3, ja3Str).Round(time.Second))
+					ctx.setCloseReason(reasonBlocked)
+					return blockConn(c, ctx, config.KindJA3, ja3Str)
+				}
+				if config.EnableJA3NCollection() {
+					go config.ReportJA3N(ja3nStr, sample)
+				}
+				if config.ShouldBlockJA3N(ja3nStr) {
+					go config.ReportJA3NBlockedEvent(ja3nStr)
+					slog.Info("[BLOCK] JA3N", "ja3n", ja3nStr, "ip", clientIP, "remaining", config.TempBlockRemaining(config.KindJA3N, ja3nStr).Round(time.Second))
+					ctx.setCloseReason(reasonBlocked)
+					return blockConn(c, ctx, config.KindJA3N, ja3nStr)
 				}
 			}
+		}
 
-			if config.EnableJA4Check() || config.EnableJA4Collection() {
-				ja4Str, err := fingerprint.JA4Fingerprint(&clientData)
-				if err == nil {
-					if config.EnableJA4Collection() {
-						go config.ReportJA4(ja4Str)
-					}
-					if config.EnableJA4Check() && config.ShouldBlockJA4(ja4Str) {
-						go config.ReportJA4BlockedEvent(ja4Str)
-						slog.Info("[BLOCK] JA4", "ja4", ja4Str, "ip", clientIP)
-						return gnet.Close
-					}
+		if config.EnableJA4Check() || config.EnableJA4Collection() || config.HasTempBlocks(config.KindJA4) || config.RateLimitUses(config.KindJA4) || config.LBHashUses(config.KindJA4) || ctx.egress || config.GetConnLimits().PerFingerprint > 0 || accessLog != nil {
+			ja4Str, ja4Raw, err := fingerprint.JA4FingerprintRaw(&hello)
+			if err != nil {
+				parseFailed = true
+			} else {
+				ctx.ja4 = ja4Str
+				if accessLog != nil {
+					ctx.ja4Raw = ja4Raw
+				}
+				countFingerprint(config.KindJA4, ja4Str)
+				if ctx.egress {
+					go config.ReportEgress(config.KindJA4, clientIP, ja4Str)
+				}
+				if config.EnableJA4Collection() {
+					go config.ReportJA4(ja4Str, sample)
+				}
+				if config.ShouldBlockJA4(ja4Str) {
+					go config.ReportJA4BlockedEvent(ja4Str)
+					slog.Info("[BLOCK] JA4", "ja4", ja4Str, "ip", clientIP, "remaining", config.TempBlockRemaining(config.KindJA4, ja4Str).Round(time.Second))
+					ctx.setCloseReason(reasonBlocked)
+					return blockConn(c, ctx, config.KindJA4, ja4Str)
 				}
 			}
 		}
 
-		targetConn, err := net.DialTimeout("tcp", ps.forwardAddr, 2*time.Second)
-		if err != nil {
-			slog.Error("连接目标失败", "err", err)
-			return gnet.Close
+		// 所有已启用的指纹算法均无法解析时视为畸形 ClientHello
+		if parseFailed && ctx.ja3 == "" && ctx.ja4 == "" {
+			class = config.FlightMalformed
+		}
+
+		// ECH 连接的 SNI 为外层公开名称，按 ech 分类应用首包策略。浏览器的 GREASE ECH 同样归入此类，见 config.FlightECH。
+		// inner 类型只能出现在加密的内层 ClientHello 中，明文中出现视为畸形
+		if ctx.hello.ECH {
+			config.IncrStat("ech:present")
+			go config.ReportECH(config.KindJA4, ctx.ja4)
+			go config.ReportECH(config.KindJA3N, ctx.ja3n)
+			switch {
+			case ctx.hello.ECHType != util.ECHOuter:
+				config.IncrStat("ech:inner_on_wire")
+				class = config.FlightMalformed
+			case class == "":
+				class = config.FlightECH
+			}
 		}
-		ctx.targetConn = targetConn
-		ctx.handshakeDone = true
+	}
 
-		go func() {
-			defer c.Close()
-			targetConn.Write(clientData)
-			io.Copy(c, targetConn)
-		}()
+	switch {
+	case ctx.bypass:
+		clientHellos.With("bypass").Inc()
+	case class == "" || class == config.FlightECH:
+		clientHellos.With("parsed").Inc()
+	default:
+		clientHellos.With(class).Inc()
+	}
 
-		return
+	// 正向代理只转发 TLS，非 TLS 与无法解析的首包默认拒绝
+	if ctx.egress && class != "" && class != config.FlightECH && !config.EgressAllowNonTLS() {
+		config.IncrStat("egress:non_tls")
+		slog.Info("[BLOCK] 出站隧道内不是 TLS", "class", class, "ip", clientIP, "target", ctx.origDst)
+		ctx.setCloseReason(reasonBlocked)
+		return blockConn(c, ctx, config.RuleFirstFlight, class)
+	}
+
+	targetAddr := ctx.origDst // 为空时从上游池中选择
+	rule, decision := "none", decisionForward
+	if class != "" {
+		rule = class
+		listener := listenerName(c)
+		policy := config.GetFirstFlightPolicy(listener, class)
+		go config.ReportFirstFlight(listener, class, policy.Action)
+		switch policy.Action {
+		case config.PolicyBlock:
+			slog.Info("[BLOCK] 首包分类", "class", class, "listener", listener, "ip", clientIP)
+			ctx.setCloseReason(reasonBlocked)
+			return blockConn(c, ctx, config.RuleFirstFlight, class)
+		case config.PolicyDivert:
+			slog.Info("[DIVERT] 首包分类", "class", class, "listener", listener, "ip", clientIP, "target", policy.DivertTarget)
+			targetAddr = policy.DivertTarget
+			decision = decisionDivert
+		case config.PolicyCount:
+			slog.Info("[COUNT] 首包分类", "class", class, "listener", listener, "ip", clientIP)
+			decision = decisionCount
+		}
+	}
+
+	if !ctx.bypass {
+		if allowed, key := config.AllowRate(clientIP, ctx.ja3n, ctx.ja4); !allowed {
+			go config.ReportRateLimitedEvent(key)
+			slog.Info("[RATELIMIT]", "key", key, "ip", clientIP)
+			ctx.setCloseReason(reasonRateLimited)
+			return blockConn(c, ctx, config.RuleRateLimit, key)
+		}
+	}
+
+	// 超出并发上限的连接在连接目标之前拒绝
+	if fp := firstNonEmpty(ctx.ja4, ctx.ja3n); fp != "" {
+		limit := config.GetConnLimits().PerFingerprint
+		if !fpConns.acquire(fp, limit) {
+			slog.Info("[CONNLIMIT] 指纹", "fp", fp, "ip", clientIP, "limit", limit)
+			ctx.setCloseReason(reasonConnLimit)
+			return blockConn(c, ctx, config.RuleConnLimit, fp)
+		}
+		ctx.fpConnKey = fp
+	}
+
+	decisions.With(rule, decision).Inc()
+	ctx.rule, ctx.decision = rule, decision
+	switch decision {
+	case decisionDivert:
+		reportEvent(c, ctx, config.EventDivert, decision, class, targetAddr)
+	case decisionCount:
+		reportEvent(c, ctx, config.EventCount, decision, class, ctx.origDst)
 	}
+	ctx.clientBuffer = nil
+	ctx.handshakeDone.Store(true)
+	ctx.handshakeTimer.Stop()
+	ctx.clientHelloTimer.Stop()
+	ctx.touch()
 
-	if ctx.targetConn != nil {
-		ctx.targetConn.Write(data)
+	connect := func() (net.Conn, error) {
+		nc, err := ps.pool.connect(ctx, targetAddr)
+		if err != nil || ctx.starttls == nil {
+			return nc, err
+		}
+		// 上游同样需要先完成明文交互，之后再转发客户端的 ClientHello
+		if err := ctx.starttls.replay(nc, config.DialTimeout()); err != nil {
+			slog.Error("上游 STARTTLS 交互失败", "target", ctx.targetAddr(), "proto", ctx.starttls.proto, "err", err)
+			nc.Close()
+			return nil, err
+		}
+		return nc, nil
+	}
+	ctx.relay = newRelay(c, ctx, clientData)
+	activeRelays.With(relayModeEventLoop).Add(1)
+	armIdleTimer(ctx.relay, ctx, config.IdleTimeout())
+	if spliceSupported && config.SpliceEnabled() {
+		ps.upstream.spliceDial(ctx.relay, connect)
+		return
 	}
+	ps.upstream.dial(ctx.relay, connect)
 	return
 }
 
-func StartProxy(listenAddr, forwardAddr string) error {
-	ps := &proxyServer{forwardAddr: forwardAddr}
-	return gnet.Run(ps, "tcp://"+listenAddr, gnet.WithMulticore(true), gnet.WithReusePort(true))
+// listenerName 返回连接所属监听器的名称（本地端口），用于读取监听器级别的配置
+func listenerName(c gnet.Conn) string {
+	_, port, err := net.SplitHostPort(c.LocalAddr().String())
+	if err != nil {
+		return c.LocalAddr().String()
+	}
+	return port
+}
+
+func newProxyServer(forwardAddr string, upstreamLoops int, opts Options) (*proxyServer, error) {
+	upstream, err := newUpstreamEngine(upstreamLoops)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyServer{pool: newUpstreamPool(forwardAddr, opts.SpoofSource), upstream: upstream, opts: opts}, nil
+}
+
+// start 启动上游 event-loop、定时器与上游健康检查
+func (ps *proxyServer) start() error {
+	wheel.start()
+	relayWheel.start()
+	go ps.pool.run()
+	go rebuildFingerprintLabels()
+	return ps.upstream.start()
+}
+
+func StartProxy(listenAddrs []string, forwardAddr string, opts Options) error {
+	if (opts.Transparent || opts.SpoofSource) && !transparentSupported {
+		return errTransparentUnsupported
+	}
+	ps, err := newProxyServer(forwardAddr, runtime.NumCPU(), opts)
+	if err != nil {
+		return err
+	}
+	if opts.AccessLog.Path != "" {
+		if accessLog, err = newAccessLogger(opts.AccessLog); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(listenAddrs)+len(opts.EgressAddrs))
+	protoAddrs := make([]string, 0, len(listenAddrs)+len(opts.EgressAddrs))
+	for _, addr := range listenAddrs {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		names = append(names, port)
+		protoAddrs = append(protoAddrs, "tcp://"+addr)
+	}
+	ps.egressPorts = make(map[string]bool, len(opts.EgressAddrs))
+	for _, addr := range opts.EgressAddrs {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		ps.egressPorts[port] = true
+		names = append(names, port)
+		protoAddrs = append(protoAddrs, "tcp://"+addr)
+	}
+	ps.starttlsPorts = make(map[string]string, len(opts.StartTLSAddrs))
+	for addr, proto := range opts.StartTLSAddrs {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		if !ValidStartTLSProto(proto) {
+			return fmt.Errorf("不支持的 STARTTLS 协议: %s", proto)
+		}
+		ps.starttlsPorts[port] = proto
+		names = append(names, port)
+		protoAddrs = append(protoAddrs, "tcp://"+addr)
+	}
+	config.SetListeners(names)
+	if err := ps.start(); err != nil {
+		return err
+	}
+
+	if opts.Transparent {
+		ps.listenPorts = make(map[string]bool, len(names))
+		for _, name := range names {
+			ps.listenPorts[name] = true
+		}
+		ps.localIPs = localIPs()
+		// TPROXY 需要监听 socket 设置 IP_TRANSPARENT：每个地址单独启动一个 engine 且不使用 SO_REUSEPORT，
+		// 使 OnBoot 中可以通过 Engine.Dup 取得唯一的监听 fd
+		errc := make(chan error, len(protoAddrs))
+		for _, addr := range protoAddrs {
+			go func(addr string) {
+				errc <- gnet.Run(ps, addr, gnet.WithMulticore(true))
+			}(addr)
+		}
+		return <-errc
+	}
+
+	return gnet.Rotate(ps, protoAddrs, gnet.WithMulticore(true), gnet.WithReusePort(true))
 }
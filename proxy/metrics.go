@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"time"
+	"tls-proxy/config"
+	"tls-proxy/metrics"
+)
+
+var (
+	connAccepted  = metrics.NewCounter("tlsproxy_connections_accepted_total", "接受的客户端连接数", "listener")
+	clientHellos  = metrics.NewCounter("tlsproxy_clienthello_total", "首包解析结果", "result")
+	decisions     = metrics.NewCounter("tlsproxy_decisions_total", "连接的处理结果，rule 为命中的规则", "rule", "action")
+	dialSeconds   = metrics.NewHistogram("tlsproxy_upstream_dial_seconds", "连接上游的耗时", metrics.DefBuckets, "upstream", "result")
+	activeRelays  = metrics.NewGauge("tlsproxy_active_relays", "正在转发的连接数", "mode")
+	relayBytes    = metrics.NewCounter("tlsproxy_relay_bytes_total", "转发的字节数，in 为客户端到上游", "direction")
+	fpConnections = metrics.NewCounter("tlsproxy_fingerprint_connections_total", "按指纹统计的连接数，需要开启 metrics_fingerprint_labels", "kind", "fingerprint")
+
+	bytesIn  = relayBytes.With("in")
+	bytesOut = relayBytes.With("out")
+
+	fpLabels = map[string]*metrics.LabelLimiter{
+		config.KindJA3:  {},
+		config.KindJA3N: {},
+		config.KindJA4:  {},
+	}
+)
+
+// 转发方式
+const (
+	relayModeEventLoop = "event_loop"
+	relayModeSplice    = "splice"
+)
+
+// 放行连接的处理结果，被阻止的连接为配置的响应方式
+const (
+	decisionForward = "forward"
+	decisionDivert  = "divert"
+	decisionCount   = "count"
+)
+
+// fpLabelRebuildInterval 为指纹标签按连接次数重新选出前 N 个的周期
+const fpLabelRebuildInterval = time.Minute
+
+// rebuildFingerprintLabels 定期重建各指纹标签的取值，同时使 metrics_fingerprint_limit 的修改生效
+func rebuildFingerprintLabels() {
+	ticker := time.NewTicker(fpLabelRebuildInterval)
+	for range ticker.C {
+		enabled, limit := config.FingerprintMetrics()
+		if !enabled {
+			continue
+		}
+		for _, l := range fpLabels {
+			l.Rebuild(limit)
+		}
+	}
+}
+
+// countFingerprint 开启指纹标签时按指纹计数
+func countFingerprint(kind, fp string) {
+	enabled, limit := config.FingerprintMetrics()
+	if !enabled || fp == "" {
+		return
+	}
+	fpConnections.With(kind, fpLabels[kind].Value(fp, limit)).Inc()
+}
+
+// countBytes 累计转发的字节数，toUpstream 为客户端到上游方向
+func (ctx *connContext) countBytes(toUpstream bool, n int64) {
+	if toUpstream {
+		ctx.bytesIn.Add(n)
+		bytesIn.Add(uint64(n))
+	} else {
+		ctx.bytesOut.Add(n)
+		bytesOut.Add(uint64(n))
+	}
+}
@@ -0,0 +1,390 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"tls-proxy/config"
+)
+
+// ringReplicas 为一致性哈希环上每单位权重的虚拟节点数
+const ringReplicas = 100
+
+var errNoUpstream = errors.New("没有可用的上游")
+
+// poolMember 为上游池中的一个地址
+type poolMember struct {
+	addr   string
+	weight int
+	active atomic.Int64 // 当前转发中的连接数
+
+	healthy      atomic.Bool  // 主动健康检查结果
+	dialFails    atomic.Int32 // 连续连接失败次数，用于被动摘除
+	ejectedUntil atomic.Int64 // 被动摘除的截止时间（UnixNano）
+
+	// 只由健康检查 goroutine 读写
+	checkFails  int
+	checkPasses int
+
+	// 平滑加权轮询的当前权重，由 pool.mu 保护
+	current int
+}
+
+func (m *poolMember) available(now int64) bool {
+	return m.healthy.Load() && m.ejectedUntil.Load() <= now
+}
+
+type ringNode struct {
+	hash   uint64
+	member *poolMember
+}
+
+// upstreamPool 按负载均衡策略选择上游。成员来自配置中的上游池，未配置时只包含启动参数指定的地址；
+// 主动健康检查失败或连续连接失败的成员暂不参与选择，全部不可用时仍在所有成员中选择，避免误判导致全部拒绝
+type upstreamPool struct {
+	fallback    string
+	spoofSource bool // 以客户端 IP 作为源地址连接上游
+
+	mu      sync.Mutex
+	members []*poolMember
+	ring    []ringNode
+}
+
+func newUpstreamPool(fallback string, spoofSource bool) *upstreamPool {
+	p := &upstreamPool{fallback: fallback, spoofSource: spoofSource}
+	p.sync()
+	return p
+}
+
+// sync 按配置更新成员，保留已有成员的连接数与健康状态
+func (p *upstreamPool) sync() {
+	want := config.UpstreamPool()
+	if len(want) == 0 {
+		want = map[string]int{p.fallback: 1}
+	}
+	p.setMembers(want)
+}
+
+// setMembers 替换成员列表并重建哈希环，成员未变化时不做任何修改
+func (p *upstreamPool) setMembers(want map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(want) == len(p.members) {
+		same := true
+		for _, m := range p.members {
+			if want[m.addr] != m.weight {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+
+	old := make(map[string]*poolMember, len(p.members))
+	for _, m := range p.members {
+		old[m.addr] = m
+	}
+	members := make([]*poolMember, 0, len(want))
+	for addr, weight := range want {
+		m, ok := old[addr]
+		if !ok {
+			m = &poolMember{addr: addr}
+			m.healthy.Store(true)
+		}
+		m.weight = weight
+		m.current = 0
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].addr < members[j].addr })
+
+	ring := make([]ringNode, 0, len(members)*ringReplicas)
+	for _, m := range members {
+		for i := 0; i < m.weight*ringReplicas; i++ {
+			ring = append(ring, ringNode{hash: hashKey(m.addr + "#" + strconv.Itoa(i)), member: m})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	p.members = members
+	p.ring = ring
+	slog.Info("[UPSTREAM] 上游池已更新", "members", len(members))
+}
+
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// pick 按策略选择一个未尝试过的成员，key 用于一致性哈希
+func (p *upstreamPool) pick(policy, key string, tried []*poolMember) *poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	excluded := func(m *poolMember) bool {
+		for _, t := range tried {
+			if t == m {
+				return true
+			}
+		}
+		return false
+	}
+	candidates := make([]*poolMember, 0, len(p.members))
+	for _, m := range p.members {
+		if m.available(now) && !excluded(m) {
+			candidates = append(candidates, m)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, m := range p.members {
+			if !excluded(m) {
+				candidates = append(candidates, m)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch policy {
+	case config.LBLeastConn:
+		best := candidates[0]
+		for _, m := range candidates[1:] {
+			if m.active.Load()*int64(best.weight) < best.active.Load()*int64(m.weight) {
+				best = m
+			}
+		}
+		return best
+	case config.LBConsistentHash:
+		h := hashKey(key)
+		start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+		for i := 0; i < len(p.ring); i++ {
+			m := p.ring[(start+i)%len(p.ring)].member
+			for _, c := range candidates {
+				if c == m {
+					return m
+				}
+			}
+		}
+		return candidates[0]
+	default:
+		// 平滑加权轮询
+		var best *poolMember
+		total := 0
+		for _, m := range candidates {
+			m.current += m.weight
+			total += m.weight
+			if best == nil || m.current > best.current {
+				best = m
+			}
+		}
+		best.current -= total
+		return best
+	}
+}
+
+// connect 连接上游：fixed 非空时直接连接该地址（首包分流），否则从池中选择，失败时换一个成员重试。
+// 选中的地址记录在 ctx 中，连接数在转发结束时由 releaseUpstream 释放
+func (p *upstreamPool) connect(ctx *connContext, fixed string) (net.Conn, error) {
+	if fixed != "" {
+		ctx.target.Store(fixed)
+		nc, err := p.dial(ctx, fixed, "direct")
+		if err != nil {
+			slog.Error("连接目标失败", "target", fixed, "err", err)
+		}
+		return nc, err
+	}
+
+	cfg := config.GetLBConfig()
+	key := ctx.lbKey(cfg.HashKey)
+	var (
+		tried   []*poolMember
+		lastErr = errNoUpstream
+	)
+	for attempt := 0; attempt <= cfg.DialRetry; attempt++ {
+		m := p.pick(cfg.Policy, key, tried)
+		if m == nil {
+			break
+		}
+		tried = append(tried, m)
+		ctx.target.Store(m.addr)
+		nc, err := p.dial(ctx, m.addr, m.addr)
+		if err != nil {
+			slog.Error("连接目标失败", "target", m.addr, "attempt", attempt+1, "err", err)
+			p.reportFailure(m, cfg)
+			lastErr = err
+			continue
+		}
+		m.dialFails.Store(0)
+		m.active.Add(1)
+		ctx.member.Store(m)
+		if ctx.closed.Load() {
+			ctx.releaseUpstream()
+		}
+		return nc, nil
+	}
+	return nil, lastErr
+}
+
+// dial 连接上游并记录耗时，label 为 metrics 中的上游标签（透明代理等直接连接的地址不作为标签）
+func (p *upstreamPool) dial(ctx *connContext, addr, label string) (net.Conn, error) {
+	d := net.Dialer{Timeout: config.DialTimeout()}
+	if p.spoofSource {
+		d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(ctx.clientIP)}
+		d.Control = transparentControl
+	}
+	if ctx.egress && addr == ctx.origDst {
+		// 正向代理的隧道目标，分流目标由运维配置，不受出站策略限制
+		spoof := d.Control
+		d.Control = func(network, address string, rc syscall.RawConn) error {
+			if err := egressControl(network, address, rc); err != nil {
+				return err
+			}
+			if spoof != nil {
+				return spoof(network, address, rc)
+			}
+			return nil
+		}
+	}
+	start := time.Now()
+	nc, err := d.Dial("tcp", addr)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	elapsed := time.Since(start)
+	ctx.dialTime.Add(int64(elapsed))
+	dialSeconds.With(label, result).Observe(elapsed.Seconds())
+	return nc, err
+}
+
+// reportFailure 记录一次连接失败，连续失败达到阈值时暂时摘除该成员
+func (p *upstreamPool) reportFailure(m *poolMember, cfg config.LBConfig) {
+	config.IncrStat("upstream:dial_failed")
+	if cfg.OutlierFailures <= 0 || int(m.dialFails.Add(1)) < cfg.OutlierFailures {
+		return
+	}
+	m.dialFails.Store(0)
+	ejection := time.Duration(cfg.OutlierEjection) * time.Second
+	m.ejectedUntil.Store(time.Now().Add(ejection).UnixNano())
+	config.IncrStat("upstream:ejected")
+	slog.Warn("[UPSTREAM] 连续连接失败，暂时摘除", "addr", m.addr, "failures", cfg.OutlierFailures, "duration", ejection)
+}
+
+// run 定期同步成员并执行主动健康检查
+func (p *upstreamPool) run() {
+	for {
+		p.sync()
+		cfg := config.GetLBConfig()
+		p.checkAll(cfg)
+		interval := time.Duration(cfg.HealthCheckInterval) * time.Millisecond
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (p *upstreamPool) checkAll(cfg config.LBConfig) {
+	p.mu.Lock()
+	members := append([]*poolMember(nil), p.members...)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, m := range members {
+		if !cfg.HealthCheck {
+			m.checkFails, m.checkPasses = 0, 0
+			m.healthy.Store(true)
+			continue
+		}
+		wg.Add(1)
+		go func(m *poolMember) {
+			defer wg.Done()
+			p.check(m, cfg)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// check 探测一个成员，连续失败 fall 次标记为不可用，连续成功 rise 次恢复
+func (p *upstreamPool) check(m *poolMember, cfg config.LBConfig) {
+	err := probe(m.addr, cfg)
+	if err != nil {
+		m.checkPasses = 0
+		m.checkFails++
+		if m.healthy.Load() && m.checkFails >= cfg.HealthCheckFall {
+			m.healthy.Store(false)
+			config.IncrStat("upstream:unhealthy")
+			slog.Warn("[UPSTREAM] 健康检查失败，标记为不可用", "addr", m.addr, "err", err)
+		}
+		return
+	}
+	m.checkFails = 0
+	m.checkPasses++
+	if !m.healthy.Load() && m.checkPasses >= cfg.HealthCheckRise {
+		m.healthy.Store(true)
+		slog.Info("[UPSTREAM] 健康检查恢复", "addr", m.addr)
+	}
+}
+
+// probe 建立一次 TCP 连接，tls 模式下额外完成 TLS 握手。
+// 只检查上游能否完成握手，不校验证书
+func probe(addr string, cfg config.LBConfig) error {
+	timeout := time.Duration(cfg.HealthCheckTimeout) * time.Millisecond
+	if cfg.HealthCheckMode != "tls" {
+		nc, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return nc.Close()
+	}
+	sni := cfg.HealthCheckSNI
+	if sni == "" {
+		sni, _, _ = net.SplitHostPort(addr)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	tc, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: sni, InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	return tc.Close()
+}
+
+// lbKey 返回一致性哈希使用的键，对应指纹未计算时退回客户端 IP
+func (ctx *connContext) lbKey(kind string) string {
+	switch kind {
+	case config.KindJA4:
+		if ctx.ja4 != "" {
+			return ctx.ja4
+		}
+	case config.KindJA3N:
+		if ctx.ja3n != "" {
+			return ctx.ja3n
+		}
+	}
+	return ctx.clientIP
+}
+
+// releaseUpstream 释放已计入上游成员的连接数
+func (ctx *connContext) releaseUpstream() {
+	if m := ctx.member.Swap(nil); m != nil {
+		m.active.Add(-1)
+	}
+}
+
+// targetAddr 返回实际连接的上游地址
+func (ctx *connContext) targetAddr() string {
+	target, _ := ctx.target.Load().(string)
+	return target
+}
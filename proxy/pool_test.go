@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"tls-proxy/config"
+)
+
+func testPool(members map[string]int) *upstreamPool {
+	p := &upstreamPool{}
+	p.setMembers(members)
+	return p
+}
+
+func TestPoolWeightedRoundRobin(t *testing.T) {
+	p := testPool(map[string]int{"a:1": 3, "b:1": 1})
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[p.pick(config.LBRoundRobin, "", nil).addr]++
+	}
+	if counts["a:1"] != 6 || counts["b:1"] != 2 {
+		t.Fatalf("加权轮询分布不正确: %v", counts)
+	}
+}
+
+func TestPoolLeastConn(t *testing.T) {
+	p := testPool(map[string]int{"a:1": 1, "b:1": 1})
+	p.members[0].active.Store(5)
+	if m := p.pick(config.LBLeastConn, "", nil); m.addr != "b:1" {
+		t.Fatalf("应选择连接数较少的成员，得到 %s", m.addr)
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	p := testPool(map[string]int{"a:1": 1, "b:1": 1, "c:1": 1})
+	before := make(map[string]string)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("10.0.0.%d", i)
+		before[key] = p.pick(config.LBConsistentHash, key, nil).addr
+		if again := p.pick(config.LBConsistentHash, key, nil).addr; again != before[key] {
+			t.Fatalf("同一个键映射到不同成员: %s %s", before[key], again)
+		}
+	}
+
+	// 移除一个成员后，原本映射到其他成员的键保持不变
+	p.setMembers(map[string]int{"a:1": 1, "b:1": 1})
+	for key, addr := range before {
+		if addr == "c:1" {
+			continue
+		}
+		if got := p.pick(config.LBConsistentHash, key, nil).addr; got != addr {
+			t.Fatalf("键 %s 从 %s 迁移到 %s", key, addr, got)
+		}
+	}
+}
+
+func TestPoolSkipsUnavailable(t *testing.T) {
+	p := testPool(map[string]int{"a:1": 1, "b:1": 1})
+	p.members[0].ejectedUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	for i := 0; i < 4; i++ {
+		if m := p.pick(config.LBRoundRobin, "", nil); m.addr != "b:1" {
+			t.Fatalf("不应选择已摘除的成员")
+		}
+	}
+	// 已尝试过可用成员时退回到不可用成员
+	if m := p.pick(config.LBRoundRobin, "", []*poolMember{p.members[1]}); m == nil || m.addr != "a:1" {
+		t.Fatalf("全部不可用时应仍能选择成员")
+	}
+	if m := p.pick(config.LBRoundRobin, "", p.members); m != nil {
+		t.Fatalf("所有成员都已尝试时应返回 nil")
+	}
+}
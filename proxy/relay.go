@@ -0,0 +1,313 @@
+package proxy
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tls-proxy/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// relayWheel 用于背压暂停期间轮询对端缓冲，精度 10ms
+var relayWheel = newTimeWheel(10*time.Millisecond, 256)
+
+// relay 连接客户端与上游两个 gnet 连接。两端各自在所属的 event-loop 中读取，
+// 通过 AsyncWrite 把数据交给对端的 event-loop 写出，任何一端都不会阻塞 event-loop。
+type relay struct {
+	ctx      *connContext
+	client   gnet.Conn
+	upstream atomic.Value // gnet.Conn，上游就绪前为空
+
+	// 以下字段只在客户端 event-loop 中访问
+	pending   [][]byte // 上游就绪前缓存的客户端数据
+	pendingN  int64
+	clientEOF bool // 客户端在上游就绪前已发送 FIN
+
+	toUpstream flow // 客户端 -> 上游
+	toClient   flow // 上游 -> 客户端
+
+	// 半关闭：先发送 FIN 的一端由 halfWriter 继续写入，另一端在数据写完后收到 FIN
+	clientHalf   atomic.Pointer[halfWriter]
+	upstreamHalf atomic.Pointer[halfWriter]
+	eofSides     atomic.Int32
+	firstFIN     atomic.Value // string，先发送 FIN 的一端对应的关闭原因
+
+	teardownOnce sync.Once
+}
+
+// flow 记录单个方向上已交给对端、但尚未写入内核的数据量，用于背压控制
+type flow struct {
+	queued   atomic.Int64 // 已提交 AsyncWrite、回调尚未执行的字节数
+	buffered atomic.Int64 // 对端 outbound 缓冲中的字节数，在对端 event-loop 中采样
+	paused   atomic.Bool  // 源端是否已暂停读取
+}
+
+func (f *flow) backlog() int64 {
+	return f.queued.Load() + f.buffered.Load()
+}
+
+// newRelay 创建转发，firstFlight 为首包判定期间缓存的数据，所有权转移给 relay
+func newRelay(c gnet.Conn, ctx *connContext, firstFlight []byte) *relay {
+	return &relay{
+		ctx:      ctx,
+		client:   c,
+		pending:  [][]byte{firstFlight},
+		pendingN: int64(len(firstFlight)),
+	}
+}
+
+// onClientTraffic 在客户端 event-loop 中处理客户端数据
+func (r *relay) onClientTraffic(c gnet.Conn) gnet.Action {
+	up := r.upstreamConn()
+	if up == nil {
+		// 上游尚未就绪，缓存数据，超过高水位后暂停读取
+		if r.pendingN >= config.RelayBufferBytes() {
+			return r.checkOverflow(c)
+		}
+		data, _ := c.Next(-1)
+		if len(data) > 0 {
+			r.ctx.touch()
+			r.pending = append(r.pending, append([]byte(nil), data...))
+			r.pendingN += int64(len(data))
+		}
+		return gnet.None
+	}
+	return r.forward(c, up, &r.toUpstream)
+}
+
+// upstreamConn 返回上游连接，尚未就绪时返回 nil
+func (r *relay) upstreamConn() gnet.Conn {
+	up, _ := r.upstream.Load().(gnet.Conn)
+	return up
+}
+
+// halfOf 返回 dst 半关闭后负责写入的 halfWriter，未半关闭时返回 nil
+func (r *relay) halfOf(dst gnet.Conn) *halfWriter {
+	if dst == r.client {
+		return r.clientHalf.Load()
+	}
+	return r.upstreamHalf.Load()
+}
+
+// onUpstreamTraffic 在上游 event-loop 中处理上游数据
+func (r *relay) onUpstreamTraffic(up gnet.Conn) gnet.Action {
+	return r.forward(up, r.client, &r.toClient)
+}
+
+// upstreamReady 在客户端 event-loop 中调用，上游连接就绪后发送缓存的数据
+func (r *relay) upstreamReady(up gnet.Conn) {
+	// 先保存再检查：与 teardown 的顺序相反，保证两者至少有一方关闭上游
+	r.upstream.Store(up)
+	if r.ctx.closed.Load() {
+		up.Close()
+		return
+	}
+	pending := r.pending
+	r.pending, r.pendingN = nil, 0
+	for _, buf := range pending {
+		r.asyncWrite(r.client, up, &r.toUpstream, buf)
+	}
+	if r.clientEOF {
+		r.sendEOF(up)
+		return
+	}
+	// 等待期间因缓存已满留在 inbound 缓冲中的数据需要重新处理
+	if r.client.InboundBuffered() > 0 {
+		r.client.Wake(nil)
+	}
+}
+
+// forward 把 src 中已读取的数据交给 dst，dst 积压过多时暂停读取 src
+func (r *relay) forward(src, dst gnet.Conn, f *flow) gnet.Action {
+	if f.backlog() >= config.RelayBufferBytes() {
+		if !f.paused.Swap(true) {
+			r.pollResume(src, dst, f)
+		}
+		return r.checkOverflow(src)
+	}
+
+	data, _ := src.Next(-1)
+	if len(data) == 0 {
+		return gnet.None
+	}
+	r.ctx.touch()
+	r.asyncWrite(src, dst, f, append([]byte(nil), data...))
+	return gnet.None
+}
+
+func (r *relay) asyncWrite(src, dst gnet.Conn, f *flow, buf []byte) {
+	n := int64(len(buf))
+	r.ctx.countBytes(dst != r.client, n)
+	f.queued.Add(n)
+	err := dst.AsyncWrite(buf, func(dc gnet.Conn, err error) error {
+		if err != nil {
+			// dst 已关闭。若是半关闭，数据按原顺序交给 halfWriter，写出后再扣减计数
+			if h := r.halfOf(dst); h != nil {
+				h.write(buf, src)
+				return nil
+			}
+			f.queued.Add(-n)
+			return nil
+		}
+		f.queued.Add(-n)
+		f.buffered.Store(int64(dc.OutboundBuffered()))
+		r.maybeResume(src, f)
+		return nil
+	})
+	if err != nil {
+		f.queued.Add(-n)
+		r.teardown(reasonClosed, false)
+	}
+}
+
+// maybeResume 积压回落到高水位的一半以下时恢复读取源端
+func (r *relay) maybeResume(src gnet.Conn, f *flow) bool {
+	if f.paused.Load() && f.backlog() < config.RelayBufferBytes()/2 {
+		if f.paused.CompareAndSwap(true, false) {
+			// 唤醒源端，重新处理暂停期间留在 inbound 缓冲中的数据
+			src.Wake(nil)
+		}
+		return true
+	}
+	return !f.paused.Load()
+}
+
+// pollResume 暂停期间对端只在可写事件中逐步写出缓冲，不会触发 AsyncWrite 回调，
+// 因此到对端 event-loop 中采样 outbound 缓冲：暂停时立即采样一次，仍未回落则每个 tick 重试
+func (r *relay) pollResume(src, dst gnet.Conn, f *flow) {
+	if r.ctx.closed.Load() {
+		return
+	}
+	dst.Wake(func(dc gnet.Conn, err error) error {
+		if err != nil {
+			return nil
+		}
+		f.buffered.Store(int64(dc.OutboundBuffered()))
+		if !r.maybeResume(src, f) {
+			relayWheel.AfterFunc(relayWheel.interval, func() { r.pollResume(src, dst, f) })
+		}
+		return nil
+	})
+}
+
+// checkOverflow 暂停期间 gnet 仍会把内核数据读入 inbound 缓冲，超过上限时断开连接
+func (r *relay) checkOverflow(src gnet.Conn) gnet.Action {
+	if int64(src.InboundBuffered()) > config.RelayMaxBufferedBytes() {
+		config.IncrStat("limit:relay_buffer")
+		r.ctx.setCloseReason(reasonRelayOverflow)
+		slog.Info("[LIMIT] 转发缓冲超过上限", "ip", r.ctx.clientIP, "buffered", src.InboundBuffered())
+		return gnet.Close
+	}
+	return gnet.None
+}
+
+// onClose 处理客户端或上游 gnet 连接的关闭，在该连接所属的 event-loop 中调用
+func (r *relay) onClose(c gnet.Conn, err error) {
+	side := sideUpstream
+	if c == r.client {
+		side = sideClient
+	}
+	reason, reset := classifyClose(side, err)
+	if reason == reasonClientFIN || reason == reasonUpstreamFIN {
+		r.onEOF(c, side, reason)
+		return
+	}
+	if err != nil {
+		slog.Debug("连接异常关闭", "side", side, "ip", r.ctx.clientIP, "err", err)
+	}
+	r.teardown(reason, reset)
+}
+
+// onEOF 一端发送 FIN：转发其剩余数据，并把 FIN 传递给另一端
+func (r *relay) onEOF(c gnet.Conn, side, reason string) {
+	if r.ctx.closed.Load() {
+		return
+	}
+	r.firstFIN.CompareAndSwap(nil, reason)
+	var data []byte
+	if buf, _ := c.Next(-1); len(buf) > 0 {
+		data = append([]byte(nil), buf...)
+	}
+	// gnet 关闭时会丢弃 outbound 中未能写出的数据，此时无法保证数据完整，直接中止
+	if c.OutboundBuffered() > 0 {
+		r.teardown(reason, true)
+		return
+	}
+
+	// 另一端仍可能向该端写数据：复制 fd 保留写方向
+	if r.eofSides.Add(1) < 2 {
+		conn, err := dupConn(c)
+		if err != nil {
+			slog.Debug("半关闭复制连接失败", "side", side, "ip", r.ctx.clientIP, "err", err)
+			r.teardown(reason, false)
+			return
+		}
+		if side == sideClient {
+			r.clientHalf.Store(newHalfWriter(r, conn, side, &r.toClient))
+		} else {
+			r.upstreamHalf.Store(newHalfWriter(r, conn, side, &r.toUpstream))
+		}
+	}
+
+	if side == sideClient {
+		up := r.upstreamConn()
+		if up == nil {
+			// 上游就绪后随缓存数据一起发送 FIN
+			if data != nil {
+				r.pending = append(r.pending, data)
+			}
+			r.clientEOF = true
+			return
+		}
+		if data != nil {
+			r.asyncWrite(c, up, &r.toUpstream, data)
+		}
+		r.sendEOF(up)
+		return
+	}
+	if data != nil {
+		r.asyncWrite(c, r.client, &r.toClient, data)
+	}
+	r.sendEOF(r.client)
+}
+
+// finReason 返回双向正常结束时的关闭原因
+func (r *relay) finReason() string {
+	if reason, ok := r.firstFIN.Load().(string); ok {
+		return reason
+	}
+	return reasonClosed
+}
+
+// teardown 关闭转发的两端并释放资源，只执行一次。reset 为 true 时向两端发送 RST
+func (r *relay) teardown(reason string, reset bool) {
+	r.ctx.setCloseReason(reason)
+	r.teardownOnce.Do(func() {
+		ctx := r.ctx
+		ctx.closed.Store(true)
+		ctx.stopTimers()
+		ctx.releaseConnLimits()
+		ctx.releaseUpstream()
+		activeRelays.With(relayModeEventLoop).Add(-1)
+		ctx.logClose()
+
+		closeConn(r.client, reset)
+		if up := r.upstreamConn(); up != nil {
+			closeConn(up, reset)
+		}
+		if h := r.clientHalf.Load(); h != nil {
+			h.close(reset)
+		}
+		if h := r.upstreamHalf.Load(); h != nil {
+			h.close(reset)
+		}
+	})
+}
+
+// Close 供空闲超时等定时器关闭整个转发
+func (r *relay) Close() error {
+	r.teardown(reasonClosed, false)
+	return nil
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var (
+	testRelayOnce sync.Once
+	testRelayAddr string
+	testRelayErr  error
+)
+
+// startTestRelay 启动单 event-loop 的代理与测试上游，单 event-loop 下任何阻塞都会影响所有连接。
+// 上游按客户端发送的第一行决定行为：echo 原样返回；half 读到 EOF 后再返回收到的全部数据；
+// reset 直接发送 RST；stall 永不读取。
+func startTestRelay(tb testing.TB) string {
+	testRelayOnce.Do(func() {
+		backend, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			testRelayErr = err
+			return
+		}
+		go serveTestBackend(backend)
+
+		ps, err := newProxyServer(backend.Addr().String(), 1, Options{})
+		if err != nil {
+			testRelayErr = err
+			return
+		}
+		if testRelayErr = ps.start(); testRelayErr != nil {
+			return
+		}
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			testRelayErr = err
+			return
+		}
+		testRelayAddr = l.Addr().String()
+		l.Close()
+		go gnet.Run(ps, "tcp://"+testRelayAddr, gnet.WithMulticore(false))
+
+		for i := 0; i < 100; i++ {
+			if c, err := net.Dial("tcp", testRelayAddr); err == nil {
+				c.Close()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		testRelayErr = io.ErrNoProgress
+	})
+	if testRelayErr != nil {
+		tb.Fatalf("start relay: %v", testRelayErr)
+	}
+	return testRelayAddr
+}
+
+func serveTestBackend(l net.Listener) {
+	var stalled []net.Conn
+	var mu sync.Mutex
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			br := bufio.NewReader(c)
+			line, err := br.ReadString('\n')
+			if err != nil {
+				c.Close()
+				return
+			}
+			switch line {
+			case "echo\n":
+				defer c.Close()
+				io.Copy(c, br)
+			case "half\n":
+				defer c.Close()
+				data, _ := io.ReadAll(br)
+				c.Write(data)
+			case "reset\n":
+				c.(*net.TCPConn).SetLinger(0)
+				c.Close()
+			default:
+				mu.Lock()
+				stalled = append(stalled, c)
+				mu.Unlock()
+			}
+		}()
+	}
+}
+
+// startStalled 建立一条上游不读取的连接，并持续写入直到被背压或断开
+func startStalled(tb testing.TB, addr string) net.Conn {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	go func() {
+		c.Write([]byte("stall\n"))
+		buf := make([]byte, 64*1024)
+		for {
+			c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if _, err := c.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func dialEcho(tb testing.TB, addr string) net.Conn {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := c.Write([]byte("echo\n")); err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+func roundTrip(c net.Conn, msg, buf []byte) error {
+	if _, err := c.Write(msg); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(msg, buf) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func TestRelayNoHeadOfLineBlocking(t *testing.T) {
+	addr := startTestRelay(t)
+
+	stalled := startStalled(t, addr)
+	defer stalled.Close()
+	// 等待上游内核缓冲被填满
+	time.Sleep(300 * time.Millisecond)
+
+	c := dialEcho(t, addr)
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	msg := bytes.Repeat([]byte("x"), 1024)
+	buf := make([]byte, len(msg))
+	var worst time.Duration
+	for i := 0; i < 100; i++ {
+		start := time.Now()
+		if err := roundTrip(c, msg, buf); err != nil {
+			t.Fatalf("round trip %d: %v", i, err)
+		}
+		if d := time.Since(start); d > worst {
+			worst = d
+		}
+	}
+	if worst > time.Second {
+		t.Fatalf("worst round trip %v with a stalled neighbour", worst)
+	}
+}
+
+func TestRelayHalfClose(t *testing.T) {
+	addr := startTestRelay(t)
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	if _, err := c.Write(append([]byte("half\n"), payload...)); err != nil {
+		t.Fatal(err)
+	}
+	// 客户端半关闭后上游才开始回复，回复完毕后客户端应收到 FIN
+	if err := c.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes after half-close, want %d", len(got), len(payload))
+	}
+}
+
+func TestRelayUpstreamReset(t *testing.T) {
+	addr := startTestRelay(t)
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := c.Write([]byte("reset\n")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(c)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("read after upstream reset: %v, want ECONNRESET", err)
+	}
+}
+
+// BenchmarkRelayThroughput 发送端最多领先接收端 relayBenchWindow 字节，模拟受 TCP 窗口约束的对端。
+// gnet 无法暂停读取 socket，回环地址上不受约束的发送端会把暂停期间的数据全部读入内存并触发缓冲上限。
+func BenchmarkRelayThroughput(b *testing.B) {
+	const relayBenchWindow = 1 << 20
+	addr := startTestRelay(b)
+	c := dialEcho(b, addr)
+	defer c.Close()
+
+	chunk := bytes.Repeat([]byte("x"), 32*1024)
+	window := make(chan struct{}, relayBenchWindow/len(chunk))
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			window <- struct{}{}
+			if _, err := c.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, len(chunk))
+	for i := 0; i < b.N; i++ {
+		if _, err := io.ReadFull(c, buf); err != nil {
+			b.Fatal(err)
+		}
+		<-window
+	}
+}
+
+func BenchmarkRelayLatency(b *testing.B) {
+	addr := startTestRelay(b)
+	stalled := startStalled(b, addr)
+	defer stalled.Close()
+	time.Sleep(300 * time.Millisecond)
+
+	c := dialEcho(b, addr)
+	defer c.Close()
+
+	msg := bytes.Repeat([]byte("x"), 64)
+	buf := make([]byte, len(msg))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := roundTrip(c, msg, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+//go:build linux
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"tls-proxy/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const spliceSupported = true
+
+// spliceChunk 为单次 ReadFrom 的上限，每完成一次刷新连接活跃时间
+const spliceChunk = 1 << 20
+
+// spliceDial 与 dial 一样在独立 goroutine 中连接上游，连接成功后回到客户端 event-loop，
+// 把客户端连接移出 event-loop，改由独立 goroutine 转发。
+// *net.TCPConn 之间的 ReadFrom 在 Linux 上通过 pipe + splice(2) 在内核中搬运数据，不经过用户态缓冲。
+// 上游不是 *net.TCPConn、客户端已半关闭或复制 fd 失败时，照常注册到上游 event-loop 转发
+func (ue *upstreamEngine) spliceDial(r *relay, connect func() (net.Conn, error)) {
+	go func() {
+		nc, err := connect()
+		if err != nil {
+			r.teardown(reasonDialFailed, false)
+			return
+		}
+		upstream, ok := nc.(*net.TCPConn)
+		if !ok {
+			slog.Debug("上游连接不支持 splice，使用 event-loop 转发", "ip", r.ctx.clientIP, "type", fmt.Sprintf("%T", nc))
+			ue.enroll(r, nc)
+			return
+		}
+		err = r.client.Wake(func(c gnet.Conn, _ error) error {
+			return ue.spliceHandoff(r, c, upstream)
+		})
+		if err != nil {
+			upstream.Close()
+		}
+	}()
+}
+
+// spliceHandoff 在客户端 event-loop 中把 relay 切换为 splice 转发，上游就绪前缓存的客户端数据作为首包发送。
+// 切换后 gnet 只关闭自己持有的 fd，复制出的 fd 继续用于转发
+func (ue *upstreamEngine) spliceHandoff(r *relay, c gnet.Conn, upstream *net.TCPConn) error {
+	ctx := r.ctx
+	if ctx.closed.Load() {
+		upstream.Close()
+		return nil
+	}
+	if r.clientEOF {
+		go ue.enroll(r, upstream)
+		return nil
+	}
+	client, err := dupConn(c)
+	if err != nil {
+		slog.Debug("splice 转发失败，使用 event-loop 转发", "ip", ctx.clientIP, "err", err)
+		go ue.enroll(r, upstream)
+		return nil
+	}
+	// 占用 teardown，此后由 finishSplice 释放资源
+	handoff := false
+	r.teardownOnce.Do(func() { handoff = true })
+	if !handoff {
+		client.Close()
+		upstream.Close()
+		return nil
+	}
+
+	var firstFlight []byte
+	for _, buf := range r.pending {
+		firstFlight = append(firstFlight, buf...)
+	}
+	if buf, _ := c.Next(-1); len(buf) > 0 {
+		firstFlight = append(firstFlight, buf...)
+	}
+	r.pending, r.pendingN = nil, 0
+
+	ctx.idleTimer.Load().Stop()
+	ctx.spliced = true
+	config.IncrStat("relay:splice")
+	activeRelays.With(relayModeEventLoop).Add(-1)
+	activeRelays.With(relayModeSplice).Add(1)
+	go func() {
+		defer ctx.finishSplice()
+		spliceRelay(ctx, client, upstream, firstFlight)
+	}()
+	return c.Close()
+}
+
+// spliceRelay 发送首包后双向转发。一个方向读到 EOF 时只关闭另一端的写方向，
+// 两个方向都结束后关闭连接；任一方向出错时向两端发送 RST
+func spliceRelay(ctx *connContext, client, upstream *net.TCPConn, firstFlight []byte) {
+	defer client.Close()
+	defer upstream.Close()
+
+	if _, err := upstream.Write(firstFlight); err != nil {
+		reason, _ := classifyClose(sideUpstream, err)
+		ctx.setCloseReason(reason)
+		return
+	}
+	ctx.countBytes(true, int64(len(firstFlight)))
+	ctx.touch()
+	armIdleTimer(client, ctx, config.IdleTimeout())
+
+	var firstFIN atomic.Value
+	errc := make(chan error, 2)
+	go func() {
+		errc <- spliceCopy(ctx, upstream, client, sideClient, &firstFIN)
+	}()
+	go func() {
+		errc <- spliceCopy(ctx, client, upstream, sideUpstream, &firstFIN)
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			client.SetLinger(0)
+			upstream.SetLinger(0)
+			client.Close()
+			upstream.Close()
+		}
+	}
+	if reason, ok := firstFIN.Load().(string); ok {
+		ctx.setCloseReason(reason)
+	}
+}
+
+// spliceCopy 用 LimitedReader 分段调用 ReadFrom，保留 splice 快速路径的同时跟踪活跃时间。
+// src 读到 EOF 后关闭 dst 的写方向；出错时记录关闭原因并返回错误
+func spliceCopy(ctx *connContext, dst, src *net.TCPConn, side string, firstFIN *atomic.Value) error {
+	lr := &io.LimitedReader{R: src}
+	for {
+		lr.N = spliceChunk
+		n, err := dst.ReadFrom(lr)
+		if n > 0 {
+			ctx.countBytes(side == sideClient, n)
+			ctx.touch()
+		}
+		if err != nil {
+			// splice 的错误无法区分来自读端还是写端，按数据来源一端记录
+			reason, _ := classifyClose(side, err)
+			ctx.setCloseReason(reason)
+			return err
+		}
+		if n == 0 {
+			reason, _ := classifyClose(side, io.EOF)
+			firstFIN.CompareAndSwap(nil, reason)
+			dst.CloseWrite()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpPair 返回一对已连接的 TCP 连接
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*net.TCPConn), b.(*net.TCPConn)
+}
+
+func TestSpliceRelay(t *testing.T) {
+	user, client := tcpPair(t)
+	upstream, backend := tcpPair(t)
+	defer user.Close()
+	defer backend.Close()
+	go func() {
+		io.Copy(backend, backend)
+		backend.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		spliceRelay(&connContext{}, client, upstream, []byte("hello"))
+		close(done)
+	}()
+
+	user.SetDeadline(time.Now().Add(5 * time.Second))
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	go user.Write(payload)
+
+	got := make([]byte, len("hello")+len(payload))
+	if _, err := io.ReadFull(user, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got[:5]) != "hello" || !bytes.Equal(got[5:], payload) {
+		t.Fatal("relayed data mismatch")
+	}
+
+	// 客户端关闭后两端都应被关闭
+	user.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not finish after client close")
+	}
+}
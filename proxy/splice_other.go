@@ -0,0 +1,12 @@
+//go:build !linux
+
+package proxy
+
+import "net"
+
+const spliceSupported = false
+
+// spliceDial 不支持 splice 时使用 event-loop 转发
+func (ue *upstreamEngine) spliceDial(r *relay, connect func() (net.Conn, error)) {
+	ue.dial(r, connect)
+}
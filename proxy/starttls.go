@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// STARTTLS 协议
+const (
+	ProtoSMTP     = "smtp"
+	ProtoIMAP     = "imap"
+	ProtoPOP3     = "pop3"
+	ProtoPostgres = "postgres"
+)
+
+// PostgreSQL SSLRequest / GSSENCRequest / CancelRequest 的请求码与 3.0 协议的 StartupMessage 版本号
+const (
+	pgSSLRequest    = 80877103
+	pgGSSENCRequest = 80877104
+	pgCancelRequest = 80877102
+	pgProtocol3     = 196608
+)
+
+var (
+	errPreamble     = errors.New("STARTTLS 之前的明文交互无效")
+	errPreambleQuit = errors.New("客户端在 STARTTLS 之前退出")
+
+	preambleHost = func() string {
+		if h, err := os.Hostname(); err == nil && h != "" {
+			return h
+		}
+		return "localhost"
+	}()
+)
+
+// ValidStartTLSProto 判断是否为支持的 STARTTLS 协议
+func ValidStartTLSProto(proto string) bool {
+	switch proto {
+	case ProtoSMTP, ProtoIMAP, ProtoPOP3, ProtoPostgres:
+		return true
+	}
+	return false
+}
+
+// startTLS 在 STARTTLS 监听器上代替上游与客户端完成明文交互，之后的 ClientHello 按普通连接检查。
+// 连接上游时由 replay 以客户端的身份重新完成同样的交互，上游的明文回复不会转发给客户端
+type startTLS struct {
+	proto  string
+	ready  bool   // 客户端已请求升级，之后的数据为 TLS
+	hello  string // 客户端的 EHLO/HELO 命令，重放给上游
+	direct bool   // 客户端未经明文交互直接发送首包（TLS 或 PostgreSQL 明文启动消息），上游同样不需要重放
+}
+
+func newStartTLS(proto string) *startTLS {
+	return &startTLS{proto: proto}
+}
+
+// greeting 返回连接建立后发送给客户端的欢迎信息
+func (s *startTLS) greeting() []byte {
+	switch s.proto {
+	case ProtoSMTP:
+		return []byte("220 " + preambleHost + " ESMTP\r\n")
+	case ProtoIMAP:
+		return []byte("* OK [CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED] ready\r\n")
+	case ProtoPOP3:
+		return []byte("+OK POP3 ready\r\n")
+	}
+	return nil
+}
+
+// handle 处理客户端的一条明文命令，返回已消费的字节数与回复；数据不完整时 n 为 0。
+// 客户端请求升级后 ready 置为 true
+func (s *startTLS) handle(buf []byte) (n int, reply []byte, err error) {
+	if len(buf) == 0 {
+		return 0, nil, nil
+	}
+	if s.proto == ProtoPostgres {
+		return s.handlePostgres(buf)
+	}
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return 0, nil, nil
+	}
+	n = i + 1
+	line := strings.TrimRight(string(buf[:i]), "\r")
+	switch s.proto {
+	case ProtoSMTP:
+		reply, err = s.handleSMTP(line)
+	case ProtoIMAP:
+		reply, err = s.handleIMAP(line)
+	case ProtoPOP3:
+		reply, err = s.handlePOP3(line)
+	}
+	return n, reply, err
+}
+
+func (s *startTLS) handleSMTP(line string) ([]byte, error) {
+	verb, _, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(verb) {
+	case "EHLO":
+		s.hello = line
+		return []byte("250-" + preambleHost + "\r\n250 STARTTLS\r\n"), nil
+	case "HELO":
+		s.hello = line
+		return []byte("250 " + preambleHost + "\r\n"), nil
+	case "STARTTLS":
+		// RFC 3207：STARTTLS 之前必须先发送 EHLO/HELO
+		if s.hello == "" {
+			return []byte("503 5.5.1 Send EHLO first\r\n"), nil
+		}
+		s.ready = true
+		return []byte("220 Ready to start TLS\r\n"), nil
+	case "NOOP", "RSET":
+		return []byte("250 OK\r\n"), nil
+	case "QUIT":
+		return []byte("221 Bye\r\n"), errPreambleQuit
+	}
+	return []byte("530 Must issue a STARTTLS command first\r\n"), nil
+}
+
+func (s *startTLS) handleIMAP(line string) ([]byte, error) {
+	tag, rest, ok := strings.Cut(line, " ")
+	if !ok || tag == "" {
+		return []byte("* BAD Invalid tag\r\n"), nil
+	}
+	cmd, _, _ := strings.Cut(rest, " ")
+	switch strings.ToUpper(cmd) {
+	case "CAPABILITY":
+		return []byte("* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED\r\n" + tag + " OK CAPABILITY completed\r\n"), nil
+	case "STARTTLS":
+		s.ready = true
+		return []byte(tag + " OK Begin TLS negotiation now\r\n"), nil
+	case "NOOP":
+		return []byte(tag + " OK NOOP completed\r\n"), nil
+	case "LOGOUT":
+		return []byte("* BYE Logging out\r\n" + tag + " OK LOGOUT completed\r\n"), errPreambleQuit
+	}
+	return []byte(tag + " BAD STARTTLS required\r\n"), nil
+}
+
+func (s *startTLS) handlePOP3(line string) ([]byte, error) {
+	cmd, _, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(cmd) {
+	case "CAPA":
+		return []byte("+OK Capability list follows\r\nSTLS\r\n.\r\n"), nil
+	case "STLS":
+		s.ready = true
+		return []byte("+OK Begin TLS negotiation\r\n"), nil
+	case "NOOP":
+		return []byte("+OK\r\n"), nil
+	case "QUIT":
+		return []byte("+OK Bye\r\n"), errPreambleQuit
+	}
+	return []byte("-ERR STLS required\r\n"), nil
+}
+
+// handlePostgres 接受 SSLRequest，拒绝 GSSENCRequest 让客户端改用 SSL；
+// 客户端直接发送 TLS（PostgreSQL 17 的 sslnegotiation=direct）时无需明文交互。
+// 不使用 SSL 的客户端直接发送明文 StartupMessage 或 CancelRequest，不消费数据，
+// 由首包判定按 nontls 分类应用首包策略
+func (s *startTLS) handlePostgres(buf []byte) (int, []byte, error) {
+	if buf[0] == 0x16 {
+		s.ready, s.direct = true, true
+		return 0, nil, nil
+	}
+	if len(buf) < 8 {
+		return 0, nil, nil
+	}
+	length, code := binary.BigEndian.Uint32(buf[0:4]), binary.BigEndian.Uint32(buf[4:8])
+	if code == pgProtocol3 || (length == 16 && code == pgCancelRequest) {
+		s.ready, s.direct = true, true
+		return 0, nil, nil
+	}
+	if length != 8 {
+		return len(buf), nil, errPreamble
+	}
+	switch code {
+	case pgSSLRequest:
+		s.ready = true
+		return 8, []byte{'S'}, nil
+	case pgGSSENCRequest:
+		return 8, []byte{'N'}, nil
+	}
+	return len(buf), nil, errPreamble
+}
+
+// replay 在新建的上游连接上以客户端身份完成明文交互，直到上游同意升级。
+// 上游在同意升级后不应再发送明文数据，读到多余数据时视为失败
+func (s *startTLS) replay(nc net.Conn, timeout time.Duration) error {
+	if s.direct {
+		return nil
+	}
+	nc.SetDeadline(time.Now().Add(timeout))
+	defer nc.SetDeadline(time.Time{})
+
+	br := bufio.NewReader(nc)
+	var err error
+	switch s.proto {
+	case ProtoSMTP:
+		err = replaySMTP(nc, br, s.hello)
+	case ProtoIMAP:
+		err = replayIMAP(nc, br)
+	case ProtoPOP3:
+		err = replayPOP3(nc, br)
+	case ProtoPostgres:
+		err = replayPostgres(nc, br)
+	}
+	if err == nil && br.Buffered() > 0 {
+		err = fmt.Errorf("上游在升级前发送了多余的数据")
+	}
+	return err
+}
+
+// readSMTPReply 读取一条（可能多行的）SMTP 回复，返回状态码
+func readSMTPReply(br *bufio.Reader) (string, error) {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if len(line) < 4 {
+			return "", fmt.Errorf("无效的 SMTP 回复: %q", line)
+		}
+		if line[3] != '-' {
+			return line[:3], nil
+		}
+	}
+}
+
+func replaySMTP(nc net.Conn, br *bufio.Reader, hello string) error {
+	if code, err := readSMTPReply(br); err != nil || code != "220" {
+		return fmt.Errorf("SMTP 欢迎信息 %s: %v", code, err)
+	}
+	if hello == "" {
+		hello = "EHLO " + preambleHost
+	}
+	if _, err := nc.Write([]byte(hello + "\r\n")); err != nil {
+		return err
+	}
+	if code, err := readSMTPReply(br); err != nil || code != "250" {
+		return fmt.Errorf("SMTP EHLO %s: %v", code, err)
+	}
+	if _, err := nc.Write([]byte("STARTTLS\r\n")); err != nil {
+		return err
+	}
+	if code, err := readSMTPReply(br); err != nil || code != "220" {
+		return fmt.Errorf("SMTP STARTTLS %s: %v", code, err)
+	}
+	return nil
+}
+
+func replayIMAP(nc net.Conn, br *bufio.Reader) error {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("IMAP 欢迎信息: %q", line)
+	}
+	if _, err := nc.Write([]byte("a STARTTLS\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "* ") {
+			continue
+		}
+		if strings.HasPrefix(line, "a OK") {
+			return nil
+		}
+		return fmt.Errorf("IMAP STARTTLS: %q", line)
+	}
+}
+
+func replayPOP3(nc net.Conn, br *bufio.Reader) error {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("POP3 欢迎信息: %q", line)
+	}
+	if _, err := nc.Write([]byte("STLS\r\n")); err != nil {
+		return err
+	}
+	line, err = br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("POP3 STLS: %q", line)
+	}
+	return nil
+}
+
+func replayPostgres(nc net.Conn, br *bufio.Reader) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], pgSSLRequest)
+	if _, err := nc.Write(req); err != nil {
+		return err
+	}
+	b, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != 'S' {
+		return fmt.Errorf("PostgreSQL 上游不支持 SSL: %q", b)
+	}
+	return nil
+}
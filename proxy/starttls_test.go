@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStartTLSHandle(t *testing.T) {
+	s := newStartTLS(ProtoSMTP)
+	buf := []byte("EHLO client\r\nSTARTTLS\r\n\x16\x03\x01")
+	for !s.ready {
+		n, _, err := s.handle(buf)
+		if err != nil || n == 0 {
+			t.Fatalf("SMTP 交互未完成: n=%d err=%v", n, err)
+		}
+		buf = buf[n:]
+	}
+	if s.hello != "EHLO client" || string(buf) != "\x16\x03\x01" {
+		t.Fatalf("hello=%q rest=%q", s.hello, buf)
+	}
+
+	pg := newStartTLS(ProtoPostgres)
+	n, reply, err := pg.handle([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f})
+	if n != 8 || string(reply) != "S" || err != nil || !pg.ready {
+		t.Fatalf("SSLRequest: n=%d reply=%q err=%v", n, reply, err)
+	}
+	direct := newStartTLS(ProtoPostgres)
+	if n, _, _ := direct.handle([]byte{0x16, 3, 1}); n != 0 || !direct.ready || !direct.direct {
+		t.Fatalf("直接 TLS 不应消费数据")
+	}
+
+	// 明文 StartupMessage 不消费数据，交给首包策略按 nontls 处理
+	plain := newStartTLS(ProtoPostgres)
+	startup := []byte{0, 0, 0, 9, 0, 3, 0, 0, 0}
+	if n, _, err := plain.handle(startup); n != 0 || err != nil || !plain.ready || !plain.direct {
+		t.Fatalf("StartupMessage: n=%d err=%v", n, err)
+	}
+
+	noHello := newStartTLS(ProtoSMTP)
+	if _, reply, _ := noHello.handle([]byte("STARTTLS\r\n")); noHello.ready || string(reply[:3]) != "503" {
+		t.Fatalf("EHLO 之前的 STARTTLS 应被拒绝: %q", reply)
+	}
+
+	imap := newStartTLS(ProtoIMAP)
+	if _, _, err := imap.handle([]byte("x LOGOUT\r\n")); err != errPreambleQuit {
+		t.Fatalf("LOGOUT 应结束连接: %v", err)
+	}
+}
+
+func TestStartTLSReplay(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		br := bufio.NewReader(server)
+		server.Write([]byte("+OK ready\r\n"))
+		if line, _ := br.ReadString('\n'); line != "STLS\r\n" {
+			return
+		}
+		server.Write([]byte("+OK begin\r\n"))
+	}()
+	if err := newStartTLS(ProtoPOP3).replay(client, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
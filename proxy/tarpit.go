@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"log/slog"
+	"math/rand"
+	"sync/atomic"
+	"time"
+	"tls-proxy/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// tarpitConns 为当前处于 tarpit 中的连接数
+var tarpitConns atomic.Int64
+
+// tarpitRecordHeader 声明一条 16KB 的握手记录，客户端会一直等待记录收齐
+var tarpitRecordHeader = []byte{0x16, 0x03, 0x03, 0x40, 0x00}
+
+// startTarpit 保持连接打开并缓慢发送数据，到期后关闭；超过全局上限时返回 false，由调用方直接关闭。
+// 先发送一个记录头，之后每个间隔发送一个随机字节。所有定时都由时间轮驱动，不为连接创建 goroutine；
+// 期间客户端发来的数据在 OnTraffic 中直接丢弃，不会连接上游。
+func startTarpit(c gnet.Conn, ctx *connContext) bool {
+	cfg := config.GetTarpitConfig()
+	if cfg.Duration <= 0 || cfg.Interval <= 0 {
+		return false
+	}
+	if tarpitConns.Add(1) > cfg.MaxConns {
+		tarpitConns.Add(-1)
+		config.IncrStat("tarpit:overflow")
+		slog.Info("[TARPIT] 超过上限，直接关闭", "ip", ctx.clientIP, "limit", cfg.MaxConns)
+		return false
+	}
+	config.IncrStat("tarpit:started")
+
+	ctx.tarpit = true
+	ctx.clientBuffer = nil
+	ctx.handshakeTimer.Stop()
+	ctx.clientHelloTimer.Stop()
+	c.Write(tarpitRecordHeader)
+	deadline := time.Now().Add(cfg.Duration)
+
+	var drip func()
+	drip = func() {
+		if ctx.closed.Load() {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.Close()
+			return
+		}
+		c.AsyncWrite([]byte{byte(rand.Intn(256))}, nil)
+		wheel.AfterFunc(cfg.Interval, drip)
+	}
+	wheel.AfterFunc(cfg.Interval, drip)
+	return true
+}
+
+// stopTarpit 连接关闭时释放 tarpit 计数
+func stopTarpit(ctx *connContext) {
+	if ctx.tarpit {
+		tarpitConns.Add(-1)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+	"tls-proxy/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// recordConn 记录写入的数据，未实现的方法调用时 panic
+type recordConn struct {
+	gnet.Conn
+	written []byte
+}
+
+func (rc *recordConn) Write(b []byte) (int, error) {
+	rc.written = append(rc.written, b...)
+	return len(b), nil
+}
+
+func TestTarpitMaxConns(t *testing.T) {
+	limit := config.GetTarpitConfig().MaxConns
+	old := tarpitConns.Swap(limit - 1)
+	t.Cleanup(func() { tarpitConns.Store(old) })
+
+	// 最后一个名额：进入 tarpit 并发送记录头
+	last, lastCtx := &recordConn{}, &connContext{clientIP: "192.0.2.1"}
+	if !startTarpit(last, lastCtx) {
+		t.Fatal("startTarpit should accept the connection that reaches the limit")
+	}
+	if !lastCtx.tarpit || !bytes.Equal(last.written, tarpitRecordHeader) || tarpitConns.Load() != limit {
+		t.Fatalf("tarpit=%v written=%x conns=%d", lastCtx.tarpit, last.written, tarpitConns.Load())
+	}
+
+	// 已满：返回 false，由 blockConn 直接关闭，不写入数据也不占用名额
+	next, nextCtx := &recordConn{}, &connContext{clientIP: "192.0.2.2"}
+	if startTarpit(next, nextCtx) {
+		t.Fatal("startTarpit should reject connections over the limit")
+	}
+	if nextCtx.tarpit || len(next.written) != 0 || tarpitConns.Load() != limit {
+		t.Errorf("tarpit=%v written=%x conns=%d", nextCtx.tarpit, next.written, tarpitConns.Load())
+	}
+	stopTarpit(nextCtx)
+	if tarpitConns.Load() != limit {
+		t.Errorf("closing a rejected connection changed the count to %d", tarpitConns.Load())
+	}
+
+	// 关闭后释放名额
+	lastCtx.closed.Store(true)
+	stopTarpit(lastCtx)
+	if !startTarpit(next, nextCtx) {
+		t.Error("startTarpit should accept a connection after one is released")
+	}
+	nextCtx.closed.Store(true)
+}
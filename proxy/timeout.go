@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"time"
+	"tls-proxy/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// wheel 负责首包超时与空闲超时，精度 100ms
+var wheel = newTimeWheel(100*time.Millisecond, 1024)
+
+// touch 记录连接最近一次收发数据的时间
+func (ctx *connContext) touch() {
+	ctx.lastActive.Store(time.Now().UnixNano())
+}
+
+// armHandshakeDeadline 连接建立后开始计时，超时仍未完成首包判定则断开，
+// 覆盖从不发送数据以及逐字节慢速发送 ClientHello 的客户端
+func armHandshakeDeadline(c gnet.Conn, ctx *connContext) {
+	d := config.HandshakeTimeout()
+	if d <= 0 {
+		return
+	}
+	ctx.handshakeTimer = wheel.AfterFunc(d, func() {
+		if ctx.handshakeDone.Load() || ctx.closed.Load() {
+			return
+		}
+		config.IncrStat("timeout:handshake")
+		slog.Info("[TIMEOUT] 首包判定超时", "ip", ctx.clientIP, "timeout", d)
+		ctx.setCloseReason(reasonHandshakeTimeout)
+		c.Close()
+	})
+}
+
+// armClientHelloDeadline 从 ClientHello 的第一个字节（正向代理与 STARTTLS 为明文交互结束后）开始计时，
+// 超时仍未收到完整的 ClientHello 则断开。客户端停止发送后不会再触发 OnTraffic，因此由定时器负责关闭
+func armClientHelloDeadline(c gnet.Conn, ctx *connContext) {
+	ctx.firstByteAt = time.Now()
+	ctx.clientHelloTimer.Stop()
+	d := config.ClientHelloTimeout()
+	if d <= 0 {
+		return
+	}
+	ctx.clientHelloTimer = wheel.AfterFunc(d, func() {
+		if ctx.handshakeDone.Load() || ctx.closed.Load() {
+			return
+		}
+		config.IncrStat("timeout:clienthello")
+		clientHellos.With("timeout").Inc()
+		slog.Info("[BLOCK] ClientHello 接收超时", "ip", ctx.clientIP, "timeout", d)
+		ctx.setCloseReason(reasonClientHelloTimeout)
+		c.Close()
+	})
+}
+
+// armIdleTimer 已建立的转发在 idle 时间内没有任何数据往来则断开
+func armIdleTimer(c io.Closer, ctx *connContext, idle time.Duration) {
+	if idle <= 0 {
+		return
+	}
+	ctx.idleTimer.Store(wheel.AfterFunc(idle, func() {
+		if ctx.closed.Load() {
+			return
+		}
+		elapsed := time.Since(time.Unix(0, ctx.lastActive.Load()))
+		if elapsed < idle {
+			armIdleTimer(c, ctx, idle-elapsed)
+			return
+		}
+		config.IncrStat("timeout:idle")
+		slog.Info("[TIMEOUT] 连接空闲超时", "ip", ctx.clientIP, "idle", elapsed.Round(time.Second))
+		ctx.setCloseReason(reasonIdleTimeout)
+		c.Close()
+	}))
+}
+
+// stopTimers 连接关闭时取消所有定时器
+func (ctx *connContext) stopTimers() {
+	ctx.handshakeTimer.Stop()
+	ctx.clientHelloTimer.Stop()
+	ctx.idleTimer.Load().Stop()
+}
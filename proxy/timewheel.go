@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeWheel 是所有 event-loop 共享的单层时间轮，用于连接级别的超时控制，
+// 避免为每个连接创建 time.Timer 或 goroutine。
+// 到期回调在时间轮自己的 goroutine 中执行，只能调用 gnet.Conn 的并发安全方法（Close、Wake 等）。
+type timeWheel struct {
+	mu       sync.Mutex
+	interval time.Duration
+	slots    [][]*wheelTimer
+	tick     uint64
+	once     sync.Once
+}
+
+type wheelTimer struct {
+	expire  uint64 // 到期的 tick
+	fn      func()
+	stopped atomic.Bool
+}
+
+// Stop 取消定时器，已取消的定时器在所在槽位下次被访问时移除
+func (t *wheelTimer) Stop() {
+	if t != nil {
+		t.stopped.Store(true)
+	}
+}
+
+func newTimeWheel(interval time.Duration, slots int) *timeWheel {
+	return &timeWheel{
+		interval: interval,
+		slots:    make([][]*wheelTimer, slots),
+	}
+}
+
+// start 启动时间轮（只启动一次）
+func (tw *timeWheel) start() {
+	tw.once.Do(func() {
+		ticker := time.NewTicker(tw.interval)
+		go func() {
+			for range ticker.C {
+				tw.advance()
+			}
+		}()
+	})
+}
+
+// AfterFunc 在 d 之后执行 fn，精度为时间轮的 interval
+func (tw *timeWheel) AfterFunc(d time.Duration, fn func()) *wheelTimer {
+	ticks := uint64((d + tw.interval - 1) / tw.interval)
+	if ticks == 0 {
+		ticks = 1
+	}
+
+	tw.mu.Lock()
+	t := &wheelTimer{expire: tw.tick + ticks, fn: fn}
+	idx := t.expire % uint64(len(tw.slots))
+	tw.slots[idx] = append(tw.slots[idx], t)
+	tw.mu.Unlock()
+	return t
+}
+
+func (tw *timeWheel) advance() {
+	tw.mu.Lock()
+	tw.tick++
+	idx := tw.tick % uint64(len(tw.slots))
+	slot := tw.slots[idx]
+	var due []*wheelTimer
+	n := 0
+	for _, t := range slot {
+		switch {
+		case t.stopped.Load():
+		case t.expire <= tw.tick:
+			due = append(due, t)
+		default:
+			slot[n] = t
+			n++
+		}
+	}
+	clear(slot[n:])
+	tw.slots[idx] = slot[:n]
+	tw.mu.Unlock()
+
+	for _, t := range due {
+		if !t.stopped.Load() {
+			t.fn()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimeWheel(t *testing.T) {
+	tw := newTimeWheel(time.Millisecond, 8)
+
+	var fired, stopped atomic.Int32
+	tw.AfterFunc(3*time.Millisecond, func() { fired.Add(1) })
+	// 超过一圈的定时器需要多转几圈才到期
+	tw.AfterFunc(20*time.Millisecond, func() { fired.Add(1) })
+	tw.AfterFunc(2*time.Millisecond, func() { stopped.Add(1) }).Stop()
+
+	for i := 0; i < 3; i++ {
+		tw.advance()
+	}
+	if fired.Load() != 1 {
+		t.Fatalf("after 3 ticks fired = %d, want 1", fired.Load())
+	}
+	for i := 0; i < 16; i++ {
+		tw.advance()
+	}
+	if fired.Load() != 1 {
+		t.Fatalf("after 19 ticks fired = %d, want 1", fired.Load())
+	}
+	tw.advance()
+	if fired.Load() != 2 {
+		t.Fatalf("after 20 ticks fired = %d, want 2", fired.Load())
+	}
+	if stopped.Load() != 0 {
+		t.Fatal("stopped timer fired")
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var (
+	errNoOriginalDst          = errors.New("无法获取原始目标地址")
+	errTransparentUnsupported = errors.New("透明代理仅支持 Linux")
+)
+
+// Options 为代理的部署模式
+type Options struct {
+	// Transparent 透明代理：配合 iptables REDIRECT / TPROXY 部署，转发到连接的原始目标地址而不是上游池
+	Transparent bool
+	// SpoofSource 连接上游时以客户端 IP 作为源地址（IP_TRANSPARENT），需要配置策略路由使回程流量经过本机
+	SpoofSource bool
+	// EgressAddrs 正向代理监听地址，接受 HTTP CONNECT / SOCKS5 隧道并对隧道内的 TLS 做同样的检查
+	EgressAddrs []string
+	// StartTLSAddrs STARTTLS 监听地址及其协议（smtp、imap、pop3、postgres）
+	StartTLSAddrs map[string]string
+	// AccessLog 访问日志，Path 为空时不记录
+	AccessLog AccessLogOptions
+}
+
+// OnBoot 透明代理模式下为监听 socket 设置 IP_TRANSPARENT，使 TPROXY 转来的连接可以被接受。
+// 设置失败时仍可用于 REDIRECT
+func (ps *proxyServer) OnBoot(eng gnet.Engine) gnet.Action {
+	if !ps.opts.Transparent {
+		return gnet.None
+	}
+	if err := setListenerTransparent(eng); err != nil {
+		slog.Warn("[WARN] 监听 socket 设置 IP_TRANSPARENT 失败，TPROXY 不可用", "err", err)
+	}
+	return gnet.None
+}
+
+// resolveOriginalDst 获取透明代理连接的原始目标地址，拒绝指向代理自身监听端口的地址以免形成转发环路
+func (ps *proxyServer) resolveOriginalDst(c gnet.Conn) (string, error) {
+	local, ok := c.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return "", errNoOriginalDst
+	}
+	return ps.chooseOriginalDst(local, func() (string, error) {
+		return natOriginalDst(c.Fd(), local.IP.To4() != nil)
+	})
+}
+
+// chooseOriginalDst 依次尝试：REDIRECT 经过 NAT，从 conntrack 中读取 SO_ORIGINAL_DST；
+// TPROXY 不修改目标地址，读取失败时本地地址即为原始目标地址
+func (ps *proxyServer) chooseOriginalDst(local *net.TCPAddr, nat func() (string, error)) (string, error) {
+	dst, err := nat()
+	if err != nil {
+		dst = local.String()
+	}
+	host, port, err := net.SplitHostPort(dst)
+	if err != nil {
+		return "", err
+	}
+	if ps.listenPorts[port] {
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ps.localIPs[ip.String()] {
+			return "", errNoOriginalDst
+		}
+	}
+	return dst, nil
+}
+
+// localIPs 返回本机所有接口地址，用于识别直接连接代理的流量
+func localIPs() map[string]bool {
+	ips := make(map[string]bool)
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		slog.Warn("[WARN] 读取本机地址失败", "err", err)
+		return ips
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			ips[ipnet.IP.String()] = true
+		}
+	}
+	return ips
+}
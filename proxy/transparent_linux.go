@@ -0,0 +1,81 @@
+//go:build linux
+
+package proxy
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const transparentSupported = true
+
+const (
+	soOriginalDst   = 80 // SO_ORIGINAL_DST 与 IP6T_SO_ORIGINAL_DST
+	ipv6Transparent = 75 // IPV6_TRANSPARENT
+)
+
+// natOriginalDst 从 conntrack 中读取 REDIRECT 之前的目标地址（SO_ORIGINAL_DST）
+func natOriginalDst(fd int, v4 bool) (string, error) {
+	if v4 {
+		// sockaddr_in 与 ipv6_mreq 同为 16 字节
+		mreq, err := syscall.GetsockoptIPv6Mreq(fd, syscall.SOL_IP, soOriginalDst)
+		if err != nil {
+			return "", err
+		}
+		return sockaddrInString(mreq.Multiaddr), nil
+	}
+	// ip6_mtuinfo 以 sockaddr_in6 开头
+	info, err := syscall.GetsockoptIPv6MTUInfo(fd, syscall.SOL_IPV6, soOriginalDst)
+	if err != nil {
+		return "", err
+	}
+	return sockaddrIn6String(&info.Addr), nil
+}
+
+// sockaddrInString 解码 sockaddr_in：family(2) port(2，网络字节序) addr(4) zero(8)
+func sockaddrInString(sa [16]byte) string {
+	ip := net.IPv4(sa[4], sa[5], sa[6], sa[7])
+	port := binary.BigEndian.Uint16(sa[2:4])
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+// sockaddrIn6String 解码 sockaddr_in6，Port 字段按内存中的网络字节序存储
+func sockaddrIn6String(sa *syscall.RawSockaddrInet6) string {
+	var port [2]byte
+	binary.NativeEndian.PutUint16(port[:], sa.Port)
+	ip := net.IP(sa.Addr[:])
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+}
+
+// setListenerTransparent 复制监听 fd 并设置 IP_TRANSPARENT，选项作用于 socket 本身，复制的 fd 用完即关闭
+func setListenerTransparent(eng gnet.Engine) error {
+	fd, err := eng.Dup()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	return setTransparent(fd)
+}
+
+// setTransparent 在 socket 上设置 IP_TRANSPARENT / IPV6_TRANSPARENT，需要 CAP_NET_ADMIN
+func setTransparent(fd int) error {
+	err4 := syscall.SetsockoptInt(fd, syscall.SOL_IP, syscall.IP_TRANSPARENT, 1)
+	err6 := syscall.SetsockoptInt(fd, syscall.SOL_IPV6, ipv6Transparent, 1)
+	if err4 != nil && err6 != nil {
+		return err4
+	}
+	return nil
+}
+
+// transparentControl 用于 net.Dialer，允许以非本机地址（客户端 IP）作为源地址连接上游
+func transparentControl(_, _ string, rc syscall.RawConn) error {
+	var err error
+	if cerr := rc.Control(func(fd uintptr) { err = setTransparent(int(fd)) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+func TestSockaddrInString(t *testing.T) {
+	// AF_INET，端口 8443，地址 203.0.113.7
+	sa := [16]byte{syscall.AF_INET, 0, 0x20, 0xfb, 203, 0, 113, 7}
+	if got := sockaddrInString(sa); got != "203.0.113.7:8443" {
+		t.Fatalf("sockaddrInString = %s", got)
+	}
+}
+
+func TestSockaddrIn6String(t *testing.T) {
+	sa := &syscall.RawSockaddrInet6{
+		Family: syscall.AF_INET6,
+		Port:   binary.NativeEndian.Uint16([]byte{0x01, 0xbb}), // 内存中为网络字节序的 443
+		Addr:   [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+	}
+	if got := sockaddrIn6String(sa); got != "[2001:db8::1]:443" {
+		t.Fatalf("sockaddrIn6String = %s", got)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"syscall"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const transparentSupported = false
+
+func natOriginalDst(_ int, _ bool) (string, error) {
+	return "", errTransparentUnsupported
+}
+
+func setListenerTransparent(_ gnet.Engine) error {
+	return errTransparentUnsupported
+}
+
+func transparentControl(_, _ string, _ syscall.RawConn) error {
+	return errTransparentUnsupported
+}
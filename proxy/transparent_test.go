@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestChooseOriginalDst(t *testing.T) {
+	ps := &proxyServer{
+		listenPorts: map[string]bool{"443": true},
+		localIPs:    map[string]bool{"192.0.2.10": true},
+	}
+	local := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}
+	nat := func(dst string, err error) func() (string, error) {
+		return func() (string, error) { return dst, err }
+	}
+
+	tests := []struct {
+		name    string
+		local   *net.TCPAddr
+		nat     func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"REDIRECT 优先使用 conntrack", local, nat("203.0.113.7:443", nil), "203.0.113.7:443", false},
+		{"TPROXY 使用本地地址", local, nat("", errors.New("ENOENT")), "198.51.100.1:443", false},
+		{"IPv6 TPROXY", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 8443}, nat("", errors.New("ENOENT")), "[2001:db8::1]:8443", false},
+		{"直接连接代理端口", &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 443}, nat("", errors.New("ENOENT")), "", true},
+		{"conntrack 指向本机监听端口", local, nat("127.0.0.1:443", nil), "", true},
+		{"本机地址的其他端口", local, nat("192.0.2.10:8443", nil), "192.0.2.10:8443", false},
+	}
+	for _, tt := range tests {
+		got, err := ps.chooseOriginalDst(tt.local, tt.nat)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, err=%v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
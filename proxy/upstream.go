@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"log/slog"
+	"net"
+	"sync/atomic"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// upstreamEngine 以 gnet 客户端模式驱动上游连接，每个 gnet.Client 对应一个 event-loop，
+// 新连接轮流分配到各个 event-loop
+type upstreamEngine struct {
+	gnet.BuiltinEventEngine
+	clients []*gnet.Client
+	next    atomic.Uint64
+}
+
+func newUpstreamEngine(loops int) (*upstreamEngine, error) {
+	if loops < 1 {
+		loops = 1
+	}
+	ue := &upstreamEngine{}
+	for i := 0; i < loops; i++ {
+		cli, err := gnet.NewClient(ue, gnet.WithTCPNoDelay(gnet.TCPNoDelay))
+		if err != nil {
+			return nil, err
+		}
+		ue.clients = append(ue.clients, cli)
+	}
+	return ue, nil
+}
+
+func (ue *upstreamEngine) start() error {
+	for _, cli := range ue.clients {
+		if err := cli.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dial 在独立 goroutine 中通过 connect 连接上游，避免阻塞客户端 event-loop。
+// 连接成功后回到客户端 event-loop 中交接，此前收到的客户端数据缓存在 relay 中。
+func (ue *upstreamEngine) dial(r *relay, connect func() (net.Conn, error)) {
+	go func() {
+		nc, err := connect()
+		if err != nil {
+			r.teardown(reasonDialFailed, false)
+			return
+		}
+		ue.enroll(r, nc)
+	}()
+}
+
+// enroll 把已连接的上游注册到上游 event-loop，并在客户端 event-loop 中交接
+func (ue *upstreamEngine) enroll(r *relay, nc net.Conn) {
+	cli := ue.clients[ue.next.Add(1)%uint64(len(ue.clients))]
+	up, err := cli.EnrollContext(nc, r)
+	if err != nil {
+		slog.Error("注册上游连接失败", "target", r.ctx.targetAddr(), "err", err)
+		r.teardown(reasonDialFailed, false)
+		return
+	}
+	err = r.client.Wake(func(_ gnet.Conn, _ error) error {
+		r.upstreamReady(up)
+		return nil
+	})
+	if err != nil {
+		up.Close()
+	}
+}
+
+func (ue *upstreamEngine) OnTraffic(up gnet.Conn) gnet.Action {
+	r, ok := up.Context().(*relay)
+	if !ok {
+		return gnet.Close
+	}
+	return r.onUpstreamTraffic(up)
+}
+
+func (ue *upstreamEngine) OnClose(up gnet.Conn, err error) gnet.Action {
+	if r, ok := up.Context().(*relay); ok {
+		r.onClose(up, err)
+	}
+	return gnet.None
+}
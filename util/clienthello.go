@@ -0,0 +1,126 @@
+package util
+
+import "errors"
+
+// TLS 扩展类型
+const (
+	ExtensionServerName = 0x0000
+	ExtensionALPN       = 0x0010
+	ExtensionECH        = 0xfe0d // encrypted_client_hello
+)
+
+// encrypted_client_hello 扩展中的 ClientHello 类型
+const (
+	ECHOuter = 0x00
+	ECHInner = 0x01
+)
+
+var ErrMalformedClientHello = errors.New("ClientHello 格式错误")
+
+// ClientHelloInfo 为 ClientHello 中用于规则判断和日志的字段。
+// 使用 ECH 时 SNI 与 ALPN 均为外层 ClientHello 中的公开值
+type ClientHelloInfo struct {
+	SNI  string
+	ALPN []string
+
+	ECH     bool // 携带 encrypted_client_hello 扩展，GREASE ECH 与真实 ECH 在外层无法区分
+	ECHType byte // ECHOuter 或 ECHInner
+}
+
+// ParseClientHello 解析 ReassembleClientHello 返回的单条 ClientHello 记录中的扩展
+func ParseClientHello(record []byte) (ClientHelloInfo, error) {
+	var info ClientHelloInfo
+	if len(record) < recordHeaderLen+handshakeHeaderLen {
+		return info, ErrMalformedClientHello
+	}
+	b := record[recordHeaderLen+handshakeHeaderLen:]
+
+	// legacy_version + random
+	if len(b) < 34 {
+		return info, ErrMalformedClientHello
+	}
+	b = b[34:]
+	var ok bool
+	if _, b, ok = readVector(b, 1); !ok { // session_id
+		return info, ErrMalformedClientHello
+	}
+	if _, b, ok = readVector(b, 2); !ok { // cipher_suites
+		return info, ErrMalformedClientHello
+	}
+	if _, b, ok = readVector(b, 1); !ok { // compression_methods
+		return info, ErrMalformedClientHello
+	}
+	if len(b) == 0 {
+		return info, nil // 没有扩展
+	}
+	exts, _, ok := readVector(b, 2)
+	if !ok {
+		return info, ErrMalformedClientHello
+	}
+	for len(exts) > 0 {
+		if len(exts) < 2 {
+			return info, ErrMalformedClientHello
+		}
+		typ := int(exts[0])<<8 | int(exts[1])
+		var data []byte
+		if data, exts, ok = readVector(exts[2:], 2); !ok {
+			return info, ErrMalformedClientHello
+		}
+		switch typ {
+		case ExtensionServerName:
+			info.SNI = parseServerName(data)
+		case ExtensionALPN:
+			info.ALPN = parseALPN(data)
+		case ExtensionECH:
+			if len(data) > 0 {
+				info.ECH = true
+				info.ECHType = data[0]
+			}
+		}
+	}
+	return info, nil
+}
+
+// readVector 读取长度前缀为 lenBytes 字节的向量，返回内容与剩余数据
+func readVector(b []byte, lenBytes int) (vec, rest []byte, ok bool) {
+	if len(b) < lenBytes {
+		return nil, nil, false
+	}
+	n := 0
+	for i := 0; i < lenBytes; i++ {
+		n = n<<8 | int(b[i])
+	}
+	b = b[lenBytes:]
+	if len(b) < n {
+		return nil, nil, false
+	}
+	return b[:n], b[n:], true
+}
+
+// parseServerName 返回 server_name 扩展中的第一个 host_name
+func parseServerName(data []byte) string {
+	list, _, ok := readVector(data, 2)
+	for ok && len(list) > 0 {
+		nameType := list[0]
+		var name []byte
+		if name, list, ok = readVector(list[1:], 2); !ok {
+			return ""
+		}
+		if nameType == 0 {
+			return string(name)
+		}
+	}
+	return ""
+}
+
+func parseALPN(data []byte) []string {
+	list, _, ok := readVector(data, 2)
+	var protos []string
+	for ok && len(list) > 0 {
+		var proto []byte
+		if proto, list, ok = readVector(list, 1); ok {
+			protos = append(protos, string(proto))
+		}
+	}
+	return protos
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+// buildHelloWithExtensions 构造携带指定扩展的 ClientHello 记录
+func buildHelloWithExtensions(exts ...[]byte) []byte {
+	body := make([]byte, 34)              // legacy_version + random
+	body = append(body, 0)                // session_id
+	body = append(body, 0, 2, 0x13, 0x01) // cipher_suites
+	body = append(body, 1, 0)             // compression_methods
+	var ext []byte
+	for _, e := range exts {
+		ext = append(ext, e...)
+	}
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+	msg := append([]byte{handshakeTypeClientHello, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{0x16, 0x03, 0x01, byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+func extension(typ int, data []byte) []byte {
+	return append([]byte{byte(typ >> 8), byte(typ), byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func TestParseClientHello(t *testing.T) {
+	sni := []byte{0, 14, 0, 0, 11}
+	sni = append(sni, "example.com"...)
+	alpn := []byte{0, 12, 2, 'h', '2', 8}
+	alpn = append(alpn, "http/1.1"...)
+	ech := []byte{ECHOuter, 0, 1, 0, 1, 7, 0, 0, 0, 0}
+
+	info, err := ParseClientHello(buildHelloWithExtensions(
+		extension(ExtensionServerName, sni),
+		extension(ExtensionALPN, alpn),
+		extension(ExtensionECH, ech),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ClientHelloInfo{SNI: "example.com", ALPN: []string{"h2", "http/1.1"}, ECH: true, ECHType: ECHOuter}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("got %+v, want %+v", info, want)
+	}
+
+	info, err = ParseClientHello(buildHelloWithExtensions(extension(ExtensionServerName, sni)))
+	if err != nil || info.ECH {
+		t.Fatalf("无 ECH 扩展: %+v %v", info, err)
+	}
+
+	truncated := buildHelloWithExtensions(extension(ExtensionECH, ech))
+	if _, err := ParseClientHello(truncated[:len(truncated)-3]); err != ErrMalformedClientHello {
+		t.Fatalf("截断的扩展应返回错误: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPTrie 是按比特位划分的前缀树，用于判断 IP 是否落在一组 CIDR 网段内，
+// IPv4 与 IPv6 分别使用独立的根节点。IPTrie 构建完成后只读，可并发查询。
+type IPTrie struct {
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+type trieNode struct {
+	child    [2]*trieNode
+	terminal bool // 从根到此节点的路径构成一个完整网段
+}
+
+func NewIPTrie() *IPTrie {
+	return &IPTrie{v4: &trieNode{}, v6: &trieNode{}}
+}
+
+// ParsePrefix 解析 CIDR 网段，也接受单个 IP（视为 /32 或 /128）。
+// IPv4 映射地址形式的网段（::ffff:a.b.c.d/n）转换为 IPv4 网段；查询时地址同样按 IPv4 处理，
+// 因此短于 /96 的映射网段无法表示，返回错误
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if p.Addr().Is4In6() {
+		if p.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("IPv4 映射网段 %s 短于 /96", s)
+		}
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
+
+// Insert 添加一个网段
+func (t *IPTrie) Insert(p netip.Prefix) {
+	node := t.v6
+	if p.Addr().Is4() {
+		node = t.v4
+	}
+	b := p.Addr().AsSlice()
+	for i := 0; i < p.Bits(); i++ {
+		bit := (b[i/8] >> (7 - i%8)) & 1
+		if node.child[bit] == nil {
+			node.child[bit] = &trieNode{}
+		}
+		node = node.child[bit]
+	}
+	if !node.terminal {
+		node.terminal = true
+		t.size++
+	}
+}
+
+// Contains 判断 IP 是否落在任一网段内
+func (t *IPTrie) Contains(addr netip.Addr) bool {
+	if t == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+	b := addr.AsSlice()
+	for i := 0; ; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == len(b)*8 {
+			return false
+		}
+		node = node.child[(b[i/8]>>(7-i%8))&1]
+		if node == nil {
+			return false
+		}
+	}
+}
+
+// Len 返回网段数量
+func (t *IPTrie) Len() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPTrie(t *testing.T) {
+	trie := NewIPTrie()
+	for _, s := range []string{"10.0.0.0/8", "192.168.1.7", "2001:db8::/32", "::ffff:172.16.0.0/108"} {
+		p, err := ParsePrefix(s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		trie.Insert(p)
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3":        true,
+		"11.0.0.1":        false,
+		"192.168.1.7":     true,
+		"192.168.1.8":     false,
+		"::ffff:10.9.9.9": true,
+		"172.16.200.1":    true,
+		"172.32.0.1":      false,
+		"2001:db8:1::1":   true,
+		"2001:db9::1":     false,
+		"::1":             false,
+	}
+	for ip, want := range cases {
+		if got := trie.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if trie.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", trie.Len())
+	}
+}
+
+func TestParsePrefixMapped(t *testing.T) {
+	trie := NewIPTrie()
+	p, err := ParsePrefix("::ffff:10.0.0.0/104")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != netip.MustParsePrefix("10.0.0.0/8") {
+		t.Fatalf("ParsePrefix(::ffff:10.0.0.0/104) = %s, want 10.0.0.0/8", p)
+	}
+	trie.Insert(p)
+	for _, ip := range []string{"10.1.2.3", "::ffff:10.1.2.3"} {
+		if !trie.Contains(netip.MustParseAddr(ip)) {
+			t.Errorf("Contains(%s) = false, want true", ip)
+		}
+	}
+
+	// 短于 /96 的映射网段会落入 IPv6 树，永远无法命中，直接拒绝
+	for _, s := range []string{"::ffff:0.0.0.0/80", "::ffff:10.0.0.0/95"} {
+		if p, err := ParsePrefix(s); err == nil {
+			t.Errorf("ParsePrefix(%s) = %s, want error", s, p)
+		}
+	}
+}
+
+func TestIPTrieDefaultRoute(t *testing.T) {
+	trie := NewIPTrie()
+	trie.Insert(netip.MustParsePrefix("0.0.0.0/0"))
+	if !trie.Contains(netip.MustParseAddr("8.8.8.8")) {
+		t.Error("0.0.0.0/0 should match any IPv4 address")
+	}
+	if trie.Contains(netip.MustParseAddr("2001:db8::1")) {
+		t.Error("0.0.0.0/0 should not match IPv6 addresses")
+	}
+}
@@ -1,11 +1,132 @@
 package util
 
+import "errors"
+
 // IsTLSClientHello 判断数据是否为 TLS ClientHello 消息（仅简单判断记录头）。
 func IsTLSClientHello(data []byte) bool {
 	return len(data) >= 5 && data[0] == 0x16 && data[1] == 0x03
 }
 
+// IsSSLv2ClientHello 判断数据是否为 SSLv2 兼容格式的 ClientHello（2 字节长度头，最高位为 1，消息类型为 1）。
+func IsSSLv2ClientHello(data []byte) bool {
+	return len(data) >= 5 && data[0]&0x80 != 0 && data[2] == 0x01 && data[3] <= 0x03
+}
+
 // IsTLSServerHello 判断数据是否为 TLS ServerHello 消息（仅简单判断记录头）。
 func IsTLSServerHello(data []byte) bool {
 	return len(data) >= 5 && data[0] == 0x16 && data[1] == 0x03
 }
+
+// TLS alert 描述码（RFC 8446 6.2）
+const (
+	AlertHandshakeFailure = 40
+	AlertAccessDenied     = 49
+	AlertUnrecognizedName = 112
+)
+
+// TLSAlert 返回一条 fatal alert 记录
+func TLSAlert(description byte) []byte {
+	return []byte{recordTypeAlert, 0x03, 0x03, 0x00, 0x02, alertLevelFatal, description}
+}
+
+const (
+	recordTypeAlert          = 0x15
+	alertLevelFatal          = 0x02
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+	recordHeaderLen          = 5
+	handshakeHeaderLen       = 4
+
+	// MaxClientHelloSize 为重组后 ClientHello 握手消息的长度上限（受合成记录头的 16 位长度限制）
+	MaxClientHelloSize = 0xffff
+)
+
+var (
+	ErrNotHandshakeRecord  = errors.New("非 TLS 握手记录")
+	ErrNotClientHello      = errors.New("握手消息不是 ClientHello")
+	ErrClientHelloTooLarge = errors.New("ClientHello 超过长度上限")
+)
+
+// ReassembleClientHello 按 TLS 记录长度解析客户端首包，重组可能跨越多个 TCP 分段、
+// 多个 TLS 记录的 ClientHello（例如携带大体积后量子密钥交换参数时）。
+//
+// 数据不足时返回 complete=false，调用方应继续等待；重组完成时 hello 为单条 TLS 记录
+// （记录头 + 完整 ClientHello 握手消息），可直接交给 JA3/JA4 解析。
+// maxSize 限制握手消息长度，超过时返回 ErrClientHelloTooLarge。
+func ReassembleClientHello(data []byte, maxSize int) (hello []byte, complete bool, err error) {
+	if maxSize <= 0 || maxSize > MaxClientHelloSize {
+		maxSize = MaxClientHelloSize
+	}
+
+	var (
+		msg    []byte // 多条记录时拼接的握手消息
+		msgLen = -1   // 握手消息总长度（含 4 字节消息头），未知时为 -1
+		offset int
+	)
+	for {
+		if len(data)-offset < recordHeaderLen {
+			return nil, false, nil
+		}
+		header := data[offset : offset+recordHeaderLen]
+		if header[0] != recordTypeHandshake || header[1] != 0x03 {
+			return nil, false, ErrNotHandshakeRecord
+		}
+		recLen := int(header[3])<<8 | int(header[4])
+		if recLen == 0 {
+			return nil, false, ErrNotHandshakeRecord
+		}
+		if len(data)-offset-recordHeaderLen < recLen {
+			// 记录本身尚未接收完整，但可以提前根据消息头判断类型和长度
+			fragment := data[offset+recordHeaderLen:]
+			if _, err := checkHandshakeHeader(append(msg, fragment...), maxSize); err != nil {
+				return nil, false, err
+			}
+			return nil, false, nil
+		}
+		fragment := data[offset+recordHeaderLen : offset+recordHeaderLen+recLen]
+
+		// 常见情况：第一条记录即包含完整的 ClientHello，无需拷贝
+		if offset == 0 && msgLen < 0 {
+			n, err := checkHandshakeHeader(fragment, maxSize)
+			if err != nil {
+				return nil, false, err
+			}
+			if n >= 0 && len(fragment) >= n {
+				return data[:recordHeaderLen+recLen], true, nil
+			}
+		}
+
+		msg = append(msg, fragment...)
+		offset += recordHeaderLen + recLen
+
+		n, err := checkHandshakeHeader(msg, maxSize)
+		if err != nil {
+			return nil, false, err
+		}
+		msgLen = n
+		if msgLen >= 0 && len(msg) >= msgLen {
+			record := make([]byte, 0, recordHeaderLen+msgLen)
+			record = append(record, recordTypeHandshake, data[1], data[2], byte(msgLen>>8), byte(msgLen))
+			record = append(record, msg[:msgLen]...)
+			return record, true, nil
+		}
+	}
+}
+
+// checkHandshakeHeader 校验握手消息头，返回消息总长度（含消息头），消息头不完整时返回 -1
+func checkHandshakeHeader(msg []byte, maxSize int) (int, error) {
+	if len(msg) == 0 {
+		return -1, nil
+	}
+	if msg[0] != handshakeTypeClientHello {
+		return -1, ErrNotClientHello
+	}
+	if len(msg) < handshakeHeaderLen {
+		return -1, nil
+	}
+	n := handshakeHeaderLen + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3]))
+	if n > maxSize {
+		return -1, ErrClientHelloTooLarge
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// buildClientHello 构造一个握手消息体长度为 bodyLen 的 ClientHello 记录
+func buildClientHello(bodyLen int) []byte {
+	msg := []byte{handshakeTypeClientHello, byte(bodyLen >> 16), byte(bodyLen >> 8), byte(bodyLen)}
+	for i := 0; i < bodyLen; i++ {
+		msg = append(msg, byte(i))
+	}
+	return append([]byte{0x16, 0x03, 0x01, byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+// splitRecords 将单条记录中的握手消息按 size 拆分为多条记录
+func splitRecords(record []byte, size int) []byte {
+	msg := record[recordHeaderLen:]
+	var out []byte
+	for len(msg) > 0 {
+		n := min(size, len(msg))
+		out = append(out, 0x16, 0x03, 0x01, byte(n>>8), byte(n))
+		out = append(out, msg[:n]...)
+		msg = msg[n:]
+	}
+	return out
+}
+
+func TestReassembleClientHelloSingleRecord(t *testing.T) {
+	record := buildClientHello(300)
+	// 追加的应用数据不影响结果
+	data := append(append([]byte{}, record...), 0x17, 0x03, 0x03)
+
+	for i := 0; i < len(record); i++ {
+		if _, complete, err := ReassembleClientHello(data[:i], 0); complete || err != nil {
+			t.Fatalf("prefix %d: complete=%v err=%v, want incomplete", i, complete, err)
+		}
+	}
+	hello, complete, err := ReassembleClientHello(data, 0)
+	if err != nil || !complete {
+		t.Fatalf("complete=%v err=%v", complete, err)
+	}
+	if !bytes.Equal(hello, record) {
+		t.Fatal("reassembled record differs from original")
+	}
+}
+
+func TestReassembleClientHelloMultipleRecords(t *testing.T) {
+	record := buildClientHello(2000)
+	data := splitRecords(record, 512)
+
+	for i := 0; i < len(data); i++ {
+		if _, complete, err := ReassembleClientHello(data[:i], 0); complete || err != nil {
+			t.Fatalf("prefix %d: complete=%v err=%v, want incomplete", i, complete, err)
+		}
+	}
+	hello, complete, err := ReassembleClientHello(data, 0)
+	if err != nil || !complete {
+		t.Fatalf("complete=%v err=%v", complete, err)
+	}
+	if !bytes.Equal(hello, record) {
+		t.Fatal("reassembled record differs from original")
+	}
+}
+
+func TestReassembleClientHelloErrors(t *testing.T) {
+	if _, _, err := ReassembleClientHello(buildClientHello(2000), 1024); !errors.Is(err, ErrClientHelloTooLarge) {
+		t.Errorf("oversized hello: err=%v, want ErrClientHelloTooLarge", err)
+	}
+	// 只有记录头和消息头时即可判断超长
+	if _, _, err := ReassembleClientHello(buildClientHello(2000)[:9], 1024); !errors.Is(err, ErrClientHelloTooLarge) {
+		t.Errorf("oversized hello header: err=%v, want ErrClientHelloTooLarge", err)
+	}
+	if _, _, err := ReassembleClientHello([]byte("GET / HTTP/1.1\r\n"), 0); !errors.Is(err, ErrNotHandshakeRecord) {
+		t.Errorf("plain http: err=%v, want ErrNotHandshakeRecord", err)
+	}
+	serverHello := buildClientHello(100)
+	serverHello[recordHeaderLen] = 0x02
+	if _, _, err := ReassembleClientHello(serverHello, 0); !errors.Is(err, ErrNotClientHello) {
+		t.Errorf("server hello: err=%v, want ErrNotClientHello", err)
+	}
+}